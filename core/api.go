@@ -47,15 +47,20 @@ import (
 	"context"
 	"errors"
 	_log "log"
+	"net/http"
 	"os"
+	"regexp"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/dosco/graphjin/core/internal/allow"
 	"github.com/dosco/graphjin/core/internal/psql"
 	"github.com/dosco/graphjin/core/internal/qcode"
 	"github.com/dosco/graphjin/core/internal/sdata"
 	"github.com/goccy/go-json"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -74,13 +79,21 @@ const (
 
 	// User role if pre-defined
 	UserRoleKey
+
+	// Tenant schema name when using schema-per-tenant
+	// multi-tenancy (see Config.Tenants)
+	TenantKey
+
+	// Tenant ID value when using a tenant column for
+	// row-level multi-tenancy (see Config.TenantColumn)
+	TenantIDKey
 )
 
 // GraphJin struct is an instance of the GraphJin engine it holds all the required information like
 // datase schemas, relationships, etc that the GraphQL to SQL compiler would need to do it's job.
 type graphjin struct {
 	conf        *Config
-	pool		*pgxpool.Pool
+	pool        *pgxpool.Pool
 	log         *_log.Logger
 	dbtype      string
 	dbinfo      *sdata.DBInfo
@@ -97,6 +110,16 @@ type graphjin struct {
 	pc          *psql.Compiler
 	subs        sync.Map
 	scripts     sync.Map
+	intro       sync.Map
+	obs         Observer
+	opts        []Option
+	replicas    []*pgxpool.Pool
+	rr          uint32
+	tenants     map[string]struct{}
+	tenantRe    *regexp.Regexp
+	rcache      ResultCache
+	rescache    ResolverCache
+	prevRes     map[string]*resCache
 }
 
 type GraphJin struct {
@@ -130,6 +153,7 @@ func newGraphJin(conf *Config, pool *pgxpool.Pool, dbinfo *sdata.DBInfo, options
 		pool:   pool,
 		dbinfo: dbinfo,
 		log:    _log.New(os.Stdout, "", 0),
+		opts:   options,
 	}
 
 	if err := gj.initAPQCache(); err != nil {
@@ -147,10 +171,18 @@ func newGraphJin(conf *Config, pool *pgxpool.Pool, dbinfo *sdata.DBInfo, options
 		}
 	}
 
+	if err := gj.initResultCache(); err != nil {
+		return nil, err
+	}
+
 	if err := gj.initDiscover(); err != nil {
 		return nil, err
 	}
 
+	if err := gj.initTenants(); err != nil {
+		return nil, err
+	}
+
 	if err := gj.initResolvers(); err != nil {
 		return nil, err
 	}
@@ -174,10 +206,6 @@ func newGraphJin(conf *Config, pool *pgxpool.Pool, dbinfo *sdata.DBInfo, options
 	return gj, nil
 }
 
-type Error struct {
-	Message string `json:"message"`
-}
-
 // Result struct contains the output of the GraphQL function this includes resulting json from the
 // database query and any error information
 type Result struct {
@@ -191,10 +219,26 @@ type Result struct {
 	Extensions   *extensions     `json:"extensions,omitempty"`
 }
 
+// Querier is a database connection or transaction that queries can be run on.
+// It is implemented by pgx.Tx, *pgx.Conn and *pgxpool.Conn
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
 // ReqConfig is used to pass request specific config values to the GraphQLEx and SubscribeEx functions. Dynamic variables can be set here.
 type ReqConfig struct {
 	APQKey string
 	Vars   map[string]interface{}
+	// StatementTimeout overrides the statement timeout in the config and role
+	StatementTimeout time.Duration
+	// UsePrimary forces the query to run on the primary database instead
+	// of a read replica (see WithReplicas)
+	UsePrimary bool
+	// Header is the headers of the HTTP request, used by the remote_api
+	// resolver to pass headers through to the remote API
+	Header http.Header
 }
 
 // GraphQL function is called on the GraphJin struct to convert the provided GraphQL query into an
@@ -208,6 +252,40 @@ func (g *GraphJin) GraphQL(
 	query string,
 	vars json.RawMessage,
 	rc *ReqConfig) (*Result, error) {
+	return g.graphQL(c, nil, query, vars, rc)
+}
+
+// GraphQLTx is the same as GraphQL but runs on the provided transaction or connection
+// (pgx.Tx, *pgx.Conn or *pgxpool.Conn) instead of one from the pool. The role query,
+// setting the user id and the compiled query (including nested mutations) all run on it.
+// Commit or rollback of the transaction is left to the caller.
+//
+// With the result cache enabled, the cached results that read from the tables changed
+// by a mutation are removed when the mutation runs and not when the transaction is
+// committed. A query run in between can cache the old data again, to prevent this call
+// InvalidateResultCache with the tables after the commit.
+//
+// A statement timeout cancels the query and pgx closes the connection it was running on,
+// when that's the provided transaction or connection it can't be used after the timeout.
+func (g *GraphJin) GraphQLTx(
+	c context.Context,
+	tx Querier,
+	query string,
+	vars json.RawMessage,
+	rc *ReqConfig) (*Result, error) {
+
+	if tx == nil {
+		return nil, errors.New("graphql: transaction or connection required")
+	}
+	return g.graphQL(c, tx, query, vars, rc)
+}
+
+func (g *GraphJin) graphQL(
+	c context.Context,
+	conn Querier,
+	query string,
+	vars json.RawMessage,
+	rc *ReqConfig) (*Result, error) {
 
 	var err error
 
@@ -217,6 +295,11 @@ func (g *GraphJin) GraphQL(
 		Context: c,
 		gj:      gj,
 		rc:      rc,
+		conn:    conn,
+	}
+
+	if gj.conf.EnableTracing {
+		ct.tr = newTrace()
 	}
 
 	if rc != nil && rc.APQKey != "" && query == "" {
@@ -227,7 +310,7 @@ func (g *GraphJin) GraphQL(
 			ct.op = v.op
 			ct.name = v.name
 		} else {
-			err = errors.New("PersistedQueryNotFound")
+			err = ErrPersistedQueryNotFound
 		}
 	} else {
 		ct.op, ct.name = qcode.GetQType(query)
@@ -239,26 +322,41 @@ func (g *GraphJin) GraphQL(
 	}
 
 	if err != nil {
-		res.Errors = []Error{{Message: err.Error()}}
-		return res, err
+		return res, res.setError(err)
 	}
 
 	if ct.op == qcode.QTSubscription {
-		return res, errors.New("use 'core.Subscribe' for subscriptions")
+		return res, res.setError(validationError(
+			errors.New("use 'core.Subscribe' for subscriptions")))
 	}
 
 	if ct.op == qcode.QTMutation && gj.schema.DBType() == "mysql" {
-		return res, errors.New("mysql: mutations not supported")
+		return res, res.setError(validationError(
+			errors.New("mysql: mutations not supported")))
 	}
 
-	var role string
+	role := userRole(c)
 
-	if v, ok := c.Value(UserRoleKey).(string); ok {
-		role = v
-	} else if c.Value(UserIDKey) != nil {
-		role = "user"
-	} else {
-		role = "anon"
+	if ct.op == qcode.QTQuery && gj.introspection() && isIntroQuery(query) {
+		data, ok, err := gj.introQuery(query, vars, role)
+		if ok || err != nil {
+			res.Data = data
+			res.role = role
+			if err != nil {
+				return res, res.setError(validationError(err))
+			}
+			return res, nil
+		}
+	}
+
+	// results are not cached when running on a transaction that could be
+	// rolled back or with request variables that are not part of the key
+	ckeys, cache := gj.resultCacheKeys(c, rc, ct.name, query, vars, role)
+	cache = cache && ct.op == qcode.QTQuery && conn == nil && (rc == nil || len(rc.Vars) == 0)
+
+	if cache && gj.getCachedResult(ckeys, res) {
+		res.role = role
+		return res, nil
 	}
 
 	qreq := queryReq{
@@ -270,7 +368,7 @@ func (g *GraphJin) GraphQL(
 	qres, err := ct.execQuery(qreq, role)
 
 	if err != nil {
-		res.Errors = []Error{{Message: err.Error()}}
+		err = res.setError(err)
 	}
 
 	if qres.qc != nil {
@@ -282,18 +380,70 @@ func (g *GraphJin) GraphQL(
 
 	res.Data = qres.data
 	res.role = qres.role
+	res.Extensions = ct.tr.finish()
+
+	// remote fields that failed to resolve are null in the data
+	if err == nil && len(qres.errs) != 0 {
+		res.Errors = qres.errs
+	}
+
+	if err == nil && qres.qc != nil && qres.qc.st.qc != nil {
+		if cache && len(res.Errors) == 0 {
+			gj.setCachedResult(ckeys, qres.qc.st.qc, res)
+		} else {
+			gj.invalidateResults(qres.qc.st.qc)
+		}
+	}
 
 	return res, err
 }
 
-// Reload does database discover and reinitializes GraphJin.
+// userRole returns the role set on the context else 'user' if
+// there is a user id or 'anon'
+func userRole(c context.Context) string {
+	if v, ok := c.Value(UserRoleKey).(string); ok {
+		return v
+	}
+	if c.Value(UserIDKey) != nil {
+		return "user"
+	}
+	return "anon"
+}
+
+// Reload does database discover and reinitializes GraphJin. Active subscriptions
+// are recompiled and kept alive, members of subscriptions that no longer compile
+// are sent the error and their result channel is closed. Remote resolver caches
+// with an unchanged config are kept.
 func (g *GraphJin) Reload() error {
 	gj := g.Load().(*graphjin)
-	gjNew, err := newGraphJin(gj.conf, gj.pool, nil)
-	if err == nil {
-		g.Store(gjNew)
+
+	opts := append([]Option{}, gj.opts...)
+	opts = append(opts, withResCaches(gj))
+
+	gjNew, err := newGraphJin(gj.conf, gj.pool, nil, opts...)
+	if err != nil {
+		return err
+	}
+	gjNew.opts = gj.opts
+	gjNew.prevRes = nil
+
+	gj.moveSubs(gjNew)
+	g.Store(gjNew)
+	return nil
+}
+
+// PersistedOperation returns the operation type and name of a persisted query
+// (APQ), in production mode the key is the name of the query in the allow list.
+// Returns false if no query is found for the key. Used to check the operation
+// type of requests that only send the key
+func (g *GraphJin) PersistedOperation(key string) (OpType, string, bool) {
+	gj := g.Load().(*graphjin)
+
+	v, ok := gj.apq.Get(key)
+	if !ok {
+		return OpUnknown, "", false
 	}
-	return err
+	return OpType(v.op), v.name, true
 }
 
 // Operation function return the operation type and name from the query.
@@ -3,8 +3,10 @@ package core
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/dosco/graphjin/core/internal/psql"
+	"github.com/dosco/graphjin/core/internal/qcode"
 	"github.com/dosco/graphjin/internal/jsn"
 	"github.com/goccy/go-json"
 )
@@ -73,6 +75,13 @@ func (gj *graphjin) argList(c context.Context, md psql.Metadata, vars []byte, rc
 				return ar, argErr(p)
 			}
 
+		case "__tenant_id":
+			if v := c.Value(TenantIDKey); v != nil {
+				vl[i] = v
+			} else {
+				return ar, argErr(p)
+			}
+
 		case "cursor":
 			if v, ok := fields["cursor"]; ok && v[0] == '"' {
 				vl[i] = string(v[1 : len(v)-1])
@@ -108,6 +117,32 @@ func (gj *graphjin) argList(c context.Context, md psql.Metadata, vars []byte, rc
 	return ar, nil
 }
 
+// validateLimitVars checks the values of the limit variables
+// are within the max limit allowed
+func validateLimitVars(qc *qcode.QCode, md psql.Metadata, ar args) error {
+	if len(qc.LimitVars) == 0 {
+		return nil
+	}
+
+	for i, p := range md.Params() {
+		if _, ok := qc.LimitVars[p.Name]; !ok {
+			continue
+		}
+		s, ok := ar.values[i].(string)
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			continue
+		}
+		if err := qc.ValidateLimitVar(p.Name, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func parseVarVal(v json.RawMessage) interface{} {
 	switch v[0] {
 	case '[', '{':
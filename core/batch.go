@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+
+	"github.com/goccy/go-json"
+)
+
+// BatchOp is a single operation (query or mutation) in a batch
+type BatchOp struct {
+	Query string
+	Vars  json.RawMessage
+	RC    *ReqConfig
+}
+
+// GraphQLBatch runs a list of operations one after the other on a single database
+// connection and returns the results in the same order. An error in one operation
+// does not affect the others. When tx is true all operations run inside a single
+// transaction, the first error rolls back the transaction and every operation fails.
+func (g *GraphJin) GraphQLBatch(c context.Context, ops []BatchOp, tx bool) ([]*Result, error) {
+	gj := g.Load().(*graphjin)
+
+	conn, err := gj.pool.Acquire(c)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	results := make([]*Result, len(ops))
+
+	if !tx {
+		for i, op := range ops {
+			results[i], _ = g.graphQL(c, conn, op.Query, op.Vars, op.RC)
+		}
+		return results, nil
+	}
+
+	t, err := conn.Begin(c)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Rollback(c) //nolint: errcheck
+
+	for i, op := range ops {
+		if results[i], err = g.graphQL(c, t, op.Query, op.Vars, op.RC); err != nil {
+			rollbackBatch(results, i)
+			return results, err
+		}
+	}
+
+	if err := t.Commit(c); err != nil {
+		rollbackBatch(results, len(results))
+		return results, err
+	}
+
+	return results, nil
+}
+
+// rollbackBatch marks all results other than the failed one as rolled back
+func rollbackBatch(results []*Result, failed int) {
+	for i := range results {
+		if i == failed {
+			continue
+		}
+		if results[i] == nil {
+			results[i] = &Result{}
+		}
+		results[i].Data = nil
+		results[i].Errors = append(results[i].Errors, newError(ErrBatchRollback))
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"sync"
 
@@ -12,8 +13,9 @@ import (
 
 type queryComp struct {
 	sync.Once
-	qr queryReq
-	st stmt
+	qr   queryReq
+	st   stmt
+	role string
 }
 
 type stmt struct {
@@ -23,7 +25,7 @@ type stmt struct {
 	sql  string
 }
 
-func (gj *graphjin) compileQuery(qr queryReq, role string) (*queryComp, error) {
+func (gj *graphjin) compileQuery(c context.Context, qr queryReq, role string, tr *trace) (*queryComp, error) {
 	var qc *queryComp
 	var err error
 	var ok bool
@@ -32,12 +34,12 @@ func (gj *graphjin) compileQuery(qr queryReq, role string) (*queryComp, error) {
 
 	if len(qr.vars) != 0 {
 		if err := json.Unmarshal(qr.vars, &vm); err != nil {
-			return nil, fmt.Errorf("variables: %w", err)
+			return nil, validationError(fmt.Errorf("variables: %w", err))
 		}
 	}
 
 	if gj.allowList == nil {
-		st, err := gj.compileQueryRole(qr, vm, role)
+		st, err := gj.compileQueryRole(c, qr, vm, role, tr)
 		if err != nil {
 			return nil, err
 		}
@@ -47,7 +49,7 @@ func (gj *graphjin) compileQuery(qr queryReq, role string) (*queryComp, error) {
 	// In production mode enforce the allow list and
 	// compile and cache the result else compile each time
 	if qc, ok = gj.queries[(qr.name + role)]; !ok {
-		return nil, errNotFound
+		return nil, ErrNotInAllowList
 	}
 	ov := qc.qr.order[0]
 
@@ -60,7 +62,7 @@ func (gj *graphjin) compileQuery(qr queryReq, role string) (*queryComp, error) {
 
 	if qc.st.sql == "" {
 		qc.Do(func() {
-			qc.st, err = gj.compileQueryRole(qc.qr, vm, role)
+			qc.st, err = gj.compileQueryRole(c, qc.qr, vm, role, tr)
 		})
 	}
 
@@ -76,20 +78,21 @@ func (gj *graphjin) orderQuery(
 
 	v, ok := vm[ov]
 	if !ok || v[0] != '"' || len(v) == 2 {
-		return nil, fmt.Errorf("required variable not set: %s", ov)
+		return nil, validationError(fmt.Errorf("required variable not set: %s", ov))
 	}
 	oval = string(v[1:(len(v) - 1)])
 
 	if qc, ok := gj.queries[(qc.qr.name + role + oval)]; ok {
 		return qc, nil
 	} else {
-		return nil, fmt.Errorf("invalid value for variable (%s): %s", ov, oval)
+		return nil, validationError(fmt.Errorf("invalid value for variable (%s): %s", ov, oval))
 	}
 }
 
 func (gj *graphjin) compileQueryRole(
+	c context.Context,
 	qr queryReq,
-	vm map[string]json.RawMessage, role string) (stmt, error) {
+	vm map[string]json.RawMessage, role string, tr *trace) (stmt, error) {
 
 	var st stmt
 	var err error
@@ -103,15 +106,35 @@ func (gj *graphjin) compileQueryRole(
 		vm[qr.order[0]] = json.RawMessage(qr.order[1])
 	}
 
-	if st.qc, err = gj.qc.Compile(qr.query, vm, st.role.Name); err != nil {
-		return st, err
+	pst := tr.now()
+	_, sp := gj.start(c, EventQCodeCompile, Attrs{OpName: qr.name, Role: role})
+
+	op, err := gj.qc.Parse(qr.query)
+	if err != nil {
+		sp.End(Attrs{}, err)
+		return st, validationError(err)
+	}
+	tr.addParsing(pst)
+
+	vst := tr.now()
+
+	st.qc, err = gj.qc.CompileOp(&op, vm, st.role.Name)
+	sp.End(Attrs{qc: st.qc}, err)
+
+	if err != nil {
+		return st, validationError(err)
 	}
 
 	var w bytes.Buffer
 
-	if st.md, err = gj.pc.Compile(&w, st.qc); err != nil {
+	_, sp = gj.start(c, EventPSQLCompile, Attrs{OpName: qr.name, Role: role, qc: st.qc})
+	st.md, err = gj.pc.Compile(&w, st.qc)
+	sp.End(Attrs{SQL: w.String()}, err)
+
+	if err != nil {
 		return st, err
 	}
+	tr.addValidation(vst)
 
 	st.sql = w.String()
 	return st, nil
@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/goccy/go-json"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// ResultCache is the store used by the result cache. Entries must expire after
+// the ttl and Invalidate must remove all entries that were set with any of the
+// tables. Use NewLRUResultCache for an in-process cache.
+type ResultCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, val []byte, tables []string, ttl time.Duration)
+	Invalidate(tables []string)
+}
+
+// WithResultCache sets the store used to cache the results of queries
+// with a @cacheControl(maxAge) directive. Setting it enables the cache
+func WithResultCache(rc ResultCache) Option {
+	return func(gj *graphjin) error {
+		gj.rcache = rc
+		return nil
+	}
+}
+
+type cacheEntry struct {
+	Data         json.RawMessage `json:"data"`
+	CacheControl string          `json:"cache_control,omitempty"`
+}
+
+func (gj *graphjin) initResultCache() error {
+	var err error
+
+	if gj.rcache != nil || !gj.conf.EnableResultCache {
+		return nil
+	}
+
+	size := gj.conf.ResultCacheSize
+	if size == 0 {
+		size = 1000
+	}
+
+	gj.rcache, err = NewLRUResultCache(size)
+	return err
+}
+
+// resultCacheKeys returns the private and public cache keys for the query.
+// Both include the operation name, APQ key, variables, role and tenant, the
+// private key also includes the user id. The query text is blank for allow
+// list queries run using the APQ key. The public key is blank when the role
+// is only known after running the role query. Returns false if the cache is
+// not enabled
+func (gj *graphjin) resultCacheKeys(c context.Context, rc *ReqConfig, name, query string,
+	vars []byte, role string) ([2]string, bool) {
+
+	var keys [2]string
+
+	if gj.rcache == nil {
+		return keys, false
+	}
+
+	var apqKey string
+	if rc != nil {
+		apqKey = rc.APQKey
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%v\x00%v\x00", name, apqKey, query, vars, role,
+		c.Value(TenantKey), c.Value(TenantIDKey))
+
+	if role != "user" || !gj.abacEnabled {
+		keys[1] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	fmt.Fprintf(h, "%v", c.Value(UserIDKey))
+	keys[0] = hex.EncodeToString(h.Sum(nil))
+
+	return keys, true
+}
+
+// getCachedResult returns the cached result if found
+func (gj *graphjin) getCachedResult(keys [2]string, res *Result) bool {
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		b, ok := gj.rcache.Get(k)
+		if !ok {
+			continue
+		}
+
+		var ce cacheEntry
+		if err := json.Unmarshal(b, &ce); err != nil {
+			return false
+		}
+
+		res.Data = ce.Data
+		res.cacheControl = ce.CacheControl
+		return true
+	}
+	return false
+}
+
+// setCachedResult caches the result of a query with a max age, the
+// public key is used if the query has a public cache scope
+func (gj *graphjin) setCachedResult(keys [2]string, qc *qcode.QCode, res *Result) {
+	if qc.Cache.MaxAge <= 0 || len(res.Data) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(cacheEntry{Data: res.Data, CacheControl: qc.Cache.Header})
+	if err != nil {
+		return
+	}
+
+	key := keys[0]
+	if strings.EqualFold(qc.Cache.Scope, "public") && keys[1] != "" {
+		key = keys[1]
+	}
+
+	gj.rcache.Set(key, b, queryTables(qc), time.Duration(qc.Cache.MaxAge)*time.Second)
+}
+
+// invalidateResults removes the cached results that read
+// from any of the tables written to by the mutation
+func (gj *graphjin) invalidateResults(qc *qcode.QCode) {
+	if gj.rcache == nil || qc.SType == qcode.QTQuery {
+		return
+	}
+
+	if tables := mutateTables(qc); len(tables) != 0 {
+		gj.rcache.Invalidate(tables)
+	}
+}
+
+// InvalidateResultCache removes the cached results that read from any of
+// the tables. Use it after committing a transaction passed to GraphQLTx
+// since the cached results are removed when the mutation runs
+func (g *GraphJin) InvalidateResultCache(tables ...string) {
+	gj := g.Load().(*graphjin)
+
+	if gj.rcache == nil || len(tables) == 0 {
+		return
+	}
+	gj.rcache.Invalidate(tables)
+}
+
+type lruResultCache struct {
+	sync.Mutex
+	lru    *lru.Cache
+	tables map[string]map[string]struct{}
+}
+
+type lruResultItem struct {
+	val    []byte
+	tables []string
+	exp    time.Time
+}
+
+// NewLRUResultCache returns an in-process LRU cache with a max
+// number of entries to be used with WithResultCache
+func NewLRUResultCache(size int) (ResultCache, error) {
+	var err error
+
+	rc := &lruResultCache{tables: make(map[string]map[string]struct{})}
+
+	rc.lru, err = lru.NewWithEvict(size, func(k, v interface{}) {
+		// called with the lock held
+		for _, t := range v.(lruResultItem).tables {
+			delete(rc.tables[t], k.(string))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+func (rc *lruResultCache) Get(key string) ([]byte, bool) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	v, ok := rc.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	item := v.(lruResultItem)
+	if time.Now().After(item.exp) {
+		rc.lru.Remove(key)
+		return nil, false
+	}
+	return item.val, true
+}
+
+func (rc *lruResultCache) Set(key string, val []byte, tables []string, ttl time.Duration) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.lru.Add(key, lruResultItem{val: val, tables: tables, exp: time.Now().Add(ttl)})
+
+	for _, t := range tables {
+		if _, ok := rc.tables[t]; !ok {
+			rc.tables[t] = make(map[string]struct{})
+		}
+		rc.tables[t][key] = struct{}{}
+	}
+}
+
+func (rc *lruResultCache) Invalidate(tables []string) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	var keys []string
+	for _, t := range tables {
+		for k := range rc.tables[t] {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		rc.lru.Remove(k)
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/goccy/go-json"
+)
+
+// CompiledQuery is the output of compiling a GraphQL query
+type CompiledQuery struct {
+	Op     OpType
+	Name   string
+	Role   string
+	SQL    string
+	Params []Param
+	Tables []string
+}
+
+// Param is a parameter of the compiled SQL query. Params are in the
+// same order as the positional parameters ($1, $2, etc) in the SQL
+type Param struct {
+	Name    string
+	Type    string
+	IsArray bool
+}
+
+// Compile compiles the GraphQL query into SQL for the role without executing
+// it or needing a database connection. Useful for building linters and other
+// tooling. The allow list is not used. Default role is 'anon'
+func (g *GraphJin) Compile(query string, vars json.RawMessage, role string) (*CompiledQuery, error) {
+	gj := g.Load().(*graphjin)
+
+	if role == "" {
+		role = "anon"
+	}
+
+	var vm map[string]json.RawMessage
+
+	if len(vars) != 0 {
+		if err := json.Unmarshal(vars, &vm); err != nil {
+			e := newError(validationError(fmt.Errorf("variables: %w", err)))
+			return nil, &e
+		}
+	}
+
+	op, name := qcode.GetQType(query)
+	qr := queryReq{op: op, name: name, query: []byte(query), vars: vars}
+
+	st, err := gj.compileQueryRole(context.Background(), qr, vm, role, nil)
+	if err != nil {
+		e := newError(err)
+		return nil, &e
+	}
+
+	cq := &CompiledQuery{
+		Op:     OpType(op),
+		Name:   name,
+		Role:   role,
+		SQL:    st.sql,
+		Tables: queryTables(st.qc),
+	}
+
+	for _, p := range st.md.Params() {
+		cq.Params = append(cq.Params, Param{Name: p.Name, Type: p.Type, IsArray: p.IsArray})
+	}
+
+	return cq, nil
+}
+
+// queryTables returns the list of tables used in the query
+// including the tables written to by a mutation
+func queryTables(qc *qcode.QCode) []string {
+	var tables []string
+	seen := make(map[string]struct{}, len(qc.Selects))
+
+	add := func(t string) {
+		if _, ok := seen[t]; ok {
+			return
+		}
+		seen[t] = struct{}{}
+		tables = append(tables, t)
+	}
+
+	for _, sel := range qc.Selects {
+		add(sel.Table)
+	}
+	for _, t := range mutateTables(qc) {
+		add(t)
+	}
+	return tables
+}
+
+// mutateTables returns the list of tables written to by the mutation
+func mutateTables(qc *qcode.QCode) []string {
+	var tables []string
+
+	for _, m := range qc.Mutates {
+		if m.Type != qcode.MTNone && m.Type != qcode.MTKeyword {
+			tables = append(tables, m.Ti.Name)
+		}
+	}
+	return tables
+}
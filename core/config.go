@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/goccy/go-json"
 )
 
 // Core struct contains core specific config value
@@ -77,11 +78,42 @@ type Config struct {
 	// Default set to 5 seconds
 	SubsPollDuration time.Duration `mapstructure:"subs_poll_every_seconds"`
 
+	// StatementTimeout is the max time a query (or a subscription poll) is
+	// allowed to run for. This can be overridden per role and per request
+	// using ReqConfig. The role query uses the config or request timeout.
+	// Default is no timeout
+	//
+	// The query is cancelled using the context deadline, on a timeout pgx
+	// closes the connection the query was running on, including a connection
+	// or transaction passed to GraphQLTx
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+
+	// Tenants is the list of tenant schemas allowed to be set using the
+	// TenantKey context value. All tenant schemas must have the same tables
+	// as the default schema. The search path is set to the tenant schema
+	// for each request
+	Tenants []string `mapstructure:"tenants"`
+
+	// TenantPattern is a regular expression that tenant schema names
+	// must match. Can be used along with or instead of Tenants
+	TenantPattern string `mapstructure:"tenant_pattern"`
+
+	// TenantColumn is the column used for row-level multi-tenancy in shared
+	// tables. Every query, update, upsert and delete on a table with this
+	// column is filtered to the TenantIDKey context value and the column is
+	// preset to it on every insert, including nested mutations
+	TenantColumn string `mapstructure:"tenant_column"`
+
 	// DefaultLimit sets the default max limit (number of rows) when a
 	// limit is not defined in the query or the table role config
 	// Default set to 20
 	DefaultLimit int `mapstructure:"default_limit"`
 
+	// Limits sets the query complexity limits (depth, selections, row limits and
+	// estimated cost). Queries over these limits are rejected before any SQL is
+	// generated. These can be overridden per role
+	Limits Limits `mapstructure:"limits"`
+
 	// DisableAgg disables all aggregation functions like count, sum, etc
 	DisableAgg bool `mapstructure:"disable_agg_functions"`
 
@@ -91,6 +123,25 @@ type Config struct {
 	// EnableCamelcase enables autp camel case terms in GraphQL to snake case in SQL
 	EnableCamelcase bool `mapstructure:"enable_camelcase"`
 
+	// DisableIntrospection disables the GraphQL introspection queries (__schema, __type)
+	// used by tools like GraphiQL to discover the schema. Introspection is always
+	// disabled when the allow list is enforced (production mode)
+	DisableIntrospection bool `mapstructure:"disable_introspection"`
+
+	// EnableTracing adds the Apollo tracing extension to the result with the
+	// parsing, validation (compile), database query and remote join timings
+	EnableTracing bool `mapstructure:"enable_tracing"`
+
+	// EnableResultCache enables an in-process LRU cache for the results of
+	// queries with a @cacheControl(maxAge) directive. Mutations remove the
+	// cached results of the tables they write to. Use WithResultCache to
+	// use another store
+	EnableResultCache bool `mapstructure:"enable_result_cache"`
+
+	// ResultCacheSize is the max number of results in the result cache.
+	// Default set to 1000
+	ResultCacheSize int `mapstructure:"result_cache_size"`
+
 	rtmap map[string]refunc
 	tmap  map[string]qcode.TConfig
 }
@@ -121,7 +172,27 @@ type Role struct {
 	Name   string
 	Match  string
 	Tables []RoleTable
-	tm     map[string]*RoleTable
+	Limits Limits
+	// StatementTimeout overrides the statement timeout in the config
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+	tm               map[string]*RoleTable
+}
+
+// Limits struct contains the query complexity limits, a value of zero
+// means no limit. Values set on a role override the ones in the config
+type Limits struct {
+	// MaxDepth is the max nesting depth of the selections in a query
+	MaxDepth int `mapstructure:"max_depth"`
+
+	// MaxSelects is the max number of selections (tables) in a query
+	MaxSelects int `mapstructure:"max_selects"`
+
+	// MaxLimit is the max limit (number of rows) allowed on any selection
+	MaxLimit int `mapstructure:"max_limit"`
+
+	// MaxCost is the max estimated number of rows a query can return. It's
+	// computed by multiplying the limits down each path of the selections
+	MaxCost int `mapstructure:"max_cost"`
 }
 
 // RoleTable struct contains role specific access control values for a database table
@@ -236,6 +307,15 @@ type Resolver interface {
 	Resolve(ResolverReq) ([]byte, error)
 }
 
+// BatchResolver is an optional interface a Resolver can implement to fetch the
+// remote data for many IDs in a single call (eg. `GET /users?ids=1,2,3`) instead
+// of one call per ID. The returned map is keyed by ID, IDs missing from the map
+// are set to null. The batch size and number of concurrent calls are set using
+// `max_batch_size` and `max_concurrency` in the resolver config.
+type BatchResolver interface {
+	ResolveBatch(BatchResolverReq) (map[string]json.RawMessage, error)
+}
+
 // ResolverProps is a map of properties from the resolver config to be passed
 // to the customer resolver's builder (new) function
 type ResolverProps map[string]interface{}
@@ -247,14 +327,49 @@ type ResolverConfig struct {
 	Schema    string
 	Table     string
 	Column    string
-	StripPath string        `mapstructure:"strip_path"`
-	Props     ResolverProps `mapstructure:",remain"`
+	StripPath string `mapstructure:"strip_path"`
+
+	// MaxBatchSize is the max number of IDs sent in a single call to a
+	// BatchResolver. Default is no limit
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+
+	// MaxConcurrency is the max number of concurrent calls to the resolver
+	// for a single request. Default is no limit
+	MaxConcurrency int `mapstructure:"max_concurrency"`
+
+	// Strict fails the whole request when the resolver returns an error,
+	// by default the field is set to null and the error added to the result
+	Strict bool `mapstructure:"strict"`
+
+	// CacheTTL caches the responses of the resolver by ID (and field
+	// arguments) for this duration. The values of the `pass_headers`
+	// are part of the cache key. Default is no caching
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+
+	// CacheSize is the max number of responses cached. Default is 1000
+	CacheSize int `mapstructure:"cache_size"`
+
+	Props ResolverProps `mapstructure:",remain"`
 }
 
 type ResolverReq struct {
 	ID  string
 	Sel *qcode.Select
 	Log *log.Logger
+
+	// Args are the arguments on the remote field (eg. `avatar(size: 64)`)
+	// with variables replaced by their values. Values are a string, int64,
+	// float64, bool, nil, []interface{} or map[string]interface{}
+	Args map[string]interface{}
+
+	*ReqConfig
+}
+
+type BatchResolverReq struct {
+	IDs  []string
+	Sel  *qcode.Select
+	Log  *log.Logger
+	Args map[string]interface{}
 	*ReqConfig
 }
 
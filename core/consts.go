@@ -5,5 +5,35 @@ import (
 )
 
 var (
-	errNotFound = errors.New("not found in prepared statements")
+	// ErrNotInAllowList is returned in production mode when the query
+	// is not found in the allow list
+	ErrNotInAllowList = errors.New("not found in allow list")
+
+	// ErrPersistedQueryNotFound is returned when the automatic persisted
+	// query (APQ) key is not found
+	ErrPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+
+	// ErrValidation is returned when the query fails to parse or
+	// is not valid for the database schema
+	ErrValidation = errors.New("validation failed")
+
+	// ErrForbidden is returned when a table, column or operation is
+	// blocked for the role
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrTimeout is returned when a query is cancelled for running longer
+	// than the statement timeout
+	ErrTimeout = errors.New("statement timeout")
+
+	// ErrConstraintViolation is returned when the database rejects a
+	// mutation due to a constraint (unique, foreign key, not null, etc)
+	ErrConstraintViolation = errors.New("constraint violation")
+
+	// ErrRemoteJoin is set on the errors of remote fields that failed to
+	// resolve, the field is set to null and the rest of the result returned
+	ErrRemoteJoin = errors.New("remote join failed")
+
+	// ErrBatchRollback is set on the results of the operations in a batch
+	// transaction that were rolled back due to another operation failing
+	ErrBatchRollback = errors.New("batch: transaction rolled back")
 )
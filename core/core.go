@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -10,7 +11,7 @@ import (
 	"github.com/dosco/graphjin/core/internal/psql"
 	"github.com/dosco/graphjin/core/internal/qcode"
 	"github.com/dosco/graphjin/core/internal/sdata"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jackc/pgx/v4"
 )
 
 type OpType int
@@ -22,31 +23,6 @@ const (
 	OpMutation
 )
 
-type extensions struct {
-	Tracing *trace `json:"tracing,omitempty"`
-}
-
-type trace struct {
-	Version   int           `json:"version"`
-	StartTime time.Time     `json:"startTime"`
-	EndTime   time.Time     `json:"endTime"`
-	Duration  time.Duration `json:"duration"`
-	Execution execution     `json:"execution"`
-}
-
-type execution struct {
-	Resolvers []resolver `json:"resolvers"`
-}
-
-type resolver struct {
-	Path        []string      `json:"path"`
-	ParentType  string        `json:"parentType"`
-	FieldName   string        `json:"fieldName"`
-	ReturnType  string        `json:"returnType"`
-	StartOffset int           `json:"startOffset"`
-	Duration    time.Duration `json:"duration"`
-}
-
 type gcontext struct {
 	context.Context
 
@@ -54,12 +30,17 @@ type gcontext struct {
 	op   qcode.QType
 	rc   *ReqConfig
 	name string
+	conn Querier
+	tr   *trace
+	// query is running on a read replica
+	replica bool
 }
 
 type queryResp struct {
 	qc   *queryComp
 	data []byte
 	role string
+	errs []Error
 }
 
 func (gj *graphjin) initDiscover() error {
@@ -147,13 +128,15 @@ func (gj *graphjin) initCompilers() error {
 	var err error
 
 	qcc := qcode.Config{
-		TConfig:          gj.conf.tmap,
-		DefaultBlock:     gj.conf.DefaultBlock,
-		DefaultLimit:     gj.conf.DefaultLimit,
-		DisableAgg:       gj.conf.DisableAgg,
-		DisableFuncs:     gj.conf.DisableFuncs,
-		EnableCamelcase:  gj.conf.EnableCamelcase,
-		DBSchema:         gj.schema.DBSchema(),
+		TConfig:         gj.conf.tmap,
+		DefaultBlock:    gj.conf.DefaultBlock,
+		DefaultLimit:    gj.conf.DefaultLimit,
+		DisableAgg:      gj.conf.DisableAgg,
+		DisableFuncs:    gj.conf.DisableFuncs,
+		EnableCamelcase: gj.conf.EnableCamelcase,
+		DBSchema:        gj.schema.DBSchema(),
+		Limits:          qcode.Limits(gj.conf.Limits),
+		TenantColumn:    gj.conf.TenantColumn,
 	}
 
 	if gj.allowList != nil {
@@ -177,27 +160,43 @@ func (gj *graphjin) initCompilers() error {
 	return nil
 }
 
-func (gj *graphjin) executeRoleQuery(c context.Context, conn *pgxpool.Conn, md psql.Metadata, vars []byte, rc *ReqConfig) (string, error) {
+func (gj *graphjin) executeRoleQuery(c context.Context, conn Querier, md psql.Metadata, vars []byte, rc *ReqConfig) (string, error) {
 	var role string
 	var ar args
 	var err error
 
+	if c.Value(UserIDKey) == nil {
+		return "anon", nil
+	}
+
 	if conn == nil {
-		if conn, err = gj.pool.Acquire(c); err != nil {
+		pc, err := gj.pool.Acquire(c)
+		if err != nil {
 			return role, err
 		}
-		defer conn.Release()
-	}
+		defer pc.Release()
+		conn = pc
 
-	if c.Value(UserIDKey) == nil {
-		return "anon", nil
+		if err := gj.setSearchPath(c, conn); err != nil {
+			return role, err
+		}
 	}
 
 	if ar, err = gj.argList(c, md, vars, rc); err != nil {
 		return "", err
 	}
 
-	err = conn.QueryRow(c, gj.roleStmt, ar.values...).Scan(&role)
+	ctx, sp := gj.start(c, EventRoleQuery, Attrs{SQL: gj.roleStmt})
+
+	// the role is not known yet so the role timeout does not apply
+	ctx, cancel := withTimeout(ctx, gj.statementTimeout(nil, rc))
+	defer cancel()
+
+	if err = conn.QueryRow(ctx, gj.roleStmt, ar.values...).Scan(&role); err != nil {
+		err = timeoutError(ctx, err)
+	}
+	sp.End(Attrs{Role: role}, err)
+
 	return role, err
 }
 
@@ -218,7 +217,7 @@ func (c *gcontext) execQuery(qr queryReq, role string) (queryResp, error) {
 	}
 
 	if qc.Remotes != 0 {
-		if res, err = c.execRemoteJoin(res); err != nil {
+		if res, err = c.execRemoteJoin(res, qr.vars); err != nil {
 			return res, err
 		}
 	}
@@ -227,81 +226,171 @@ func (c *gcontext) execQuery(qr queryReq, role string) (queryResp, error) {
 }
 
 func (c *gcontext) resolveSQL(qr queryReq, role string) (queryResp, error) {
-	var res queryResp
-	var err error
+	conn := c.conn
 
-	res.role = role
+	if conn == nil {
+		pool := c.gj.pool
+
+		if c.usesReplica(qr.op) {
+			pool, c.replica = c.gj.readPool(), true
+		}
+
+		pc, err := pool.Acquire(c)
+		if err != nil {
+			return queryResp{role: role}, err
+		}
+		defer pc.Release()
+		conn = pc
+	}
 
-	conn, err := c.gj.pool.Acquire(c)
+	res, args, err := c.prepareSQL(conn, qr, role)
 	if err != nil {
 		return res, err
 	}
-	defer conn.Release()
+
+	st := c.tr.now()
+	ctx, sp := c.gj.start(c, EventDBQuery, Attrs{
+		OpName: qr.name,
+		Role:   res.role,
+		SQL:    res.qc.st.sql,
+		qc:     res.qc.st.qc,
+	})
+
+	ctx, cancel := withTimeout(ctx, c.gj.statementTimeout(res.qc.st.role, c.rc))
+	defer cancel()
+
+	rows, err := conn.Query(ctx, res.qc.st.sql, args.values...)
+	if err != nil {
+		err = timeoutError(ctx, err)
+		sp.End(Attrs{}, err)
+		return res, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		values := rows.RawValues()
+		if len(values) != 0 {
+			res.data = values[0]
+			c.tr.addQuery(res.qc.st.qc, st)
+			sp.End(Attrs{}, nil)
+
+			if c.rc != nil && c.rc.APQKey != "" {
+				c.gj.apq.Set(c.rc.APQKey, apqInfo{op: qr.op, name: qr.name, query: string(qr.query)})
+			}
+			return res, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		err = timeoutError(ctx, err)
+		sp.End(Attrs{}, err)
+		return res, err
+	}
+
+	sp.End(Attrs{}, sql.ErrNoRows)
+	return res, sql.ErrNoRows
+}
+
+// prepareSQL sets the user id, resolves the role and compiles the
+// query returning the arguments to execute it with
+func (c *gcontext) prepareSQL(conn Querier, qr queryReq, role string) (queryResp, args, error) {
+	var res queryResp
+	var ar args
+	var err error
+
+	res.role = role
 
 	if c.gj.conf.SetUserID {
 		if err := c.setLocalUserID(conn); err != nil {
-			return res, err
+			return res, ar, err
 		}
 	}
 
+	if err := c.gj.setSearchPath(c, conn); err != nil {
+		return res, ar, err
+	}
+
 	if v := c.Value(UserRoleKey); v != nil {
 		res.role = v.(string)
 
 	} else if c.gj.abacEnabled {
-		res.role, err = c.gj.executeRoleQuery(c, conn, c.gj.roleStmtMD, qr.vars, c.rc)
+		// the role query always runs on the primary
+		rconn := conn
+		if c.replica {
+			rconn = nil
+		}
+		res.role, err = c.gj.executeRoleQuery(c, rconn, c.gj.roleStmtMD, qr.vars, c.rc)
 	}
 
 	if err != nil {
-		return res, err
+		return res, ar, err
 	}
 
-	if res.qc, err = c.gj.compileQuery(qr, res.role); err != nil {
-		return res, err
+	if res.qc, err = c.gj.compileQuery(c, qr, res.role, c.tr); err != nil {
+		return res, ar, err
 	}
 
-	args, err := c.gj.argList(c, res.qc.st.md, qr.vars, c.rc)
-	if err != nil {
-		return res, err
+	if ar, err = c.gj.argList(c, res.qc.st.md, qr.vars, c.rc); err != nil {
+		return res, ar, validationError(err)
 	}
 
-	// var stime time.Time
+	if err := validateLimitVars(res.qc.st.qc, res.qc.st.md, ar); err != nil {
+		return res, ar, err
+	}
 
-	// if c.gj.conf.EnableTracing {
-	// 	stime = time.Now()
-	// }
+	return res, ar, nil
+}
 
-	rows, err := conn.Query(c, res.qc.st.sql, args.values...)
-	if err != nil {
-		return res, err
+// statementTimeout returns the query timeout, the request config
+// overrides the role which overrides the config
+func (gj *graphjin) statementTimeout(r *Role, rc *ReqConfig) time.Duration {
+	switch {
+	case rc != nil && rc.StatementTimeout != 0:
+		return rc.StatementTimeout
+	case r != nil && r.StatementTimeout != 0:
+		return r.StatementTimeout
+	default:
+		return gj.conf.StatementTimeout
 	}
-	defer rows.Close()
+}
 
-	if rows.Next() {
-		values := rows.RawValues()
-		if len(values) != 0 {
-			res.data = values[0]
-			if c.rc != nil && c.rc.APQKey != "" {
-				c.gj.apq.Set(c.rc.APQKey, apqInfo{op: qr.op, name: qr.name, query: string(qr.query)})
-			}
-			return res, nil
-		}
+// withTimeout returns a context that is cancelled once the timeout
+// is up, a zero timeout means no timeout
+func withTimeout(c context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d == 0 {
+		return c, func() {}
 	}
+	return context.WithTimeout(c, d)
+}
 
-	return res, sql.ErrNoRows
+// timeoutError marks the error as a timeout if the query
+// was cancelled by the context deadline
+func timeoutError(c context.Context, err error) error {
+	if errors.Is(c.Err(), context.DeadlineExceeded) {
+		return &kindError{kind: ErrTimeout, err: err}
+	}
+	return err
 }
 
-func (c *gcontext) setLocalUserID(conn *pgxpool.Conn) error {
+func (c *gcontext) setLocalUserID(conn Querier) error {
 	var err error
 
+	// within a transaction the user id is only set till the
+	// transaction ends
+	scope := "SESSION"
+	if _, ok := conn.(pgx.Tx); ok {
+		scope = "LOCAL"
+	}
+
 	if v := c.Value(UserIDKey); v == nil {
 		return nil
 	} else {
 		switch v1 := v.(type) {
 		case string:
-			_, err = conn.Exec(c, `SET SESSION "user.id" = '`+v1+`'`)
+			_, err = conn.Exec(c, `SET `+scope+` "user.id" = '`+v1+`'`)
 
 		case int:
-			_, err = conn.Exec(c, `SET SESSION "user.id" = `+strconv.Itoa(v1))
+			_, err = conn.Exec(c, `SET `+scope+` "user.id" = `+strconv.Itoa(v1))
 		}
 	}
 
@@ -341,49 +430,6 @@ func (r *Result) CacheControl() string {
 	return r.cacheControl
 }
 
-// func (c *gcontext) addTrace(sel []qcode.Select, id int32, st time.Time) {
-// 	et := time.Now()
-// 	du := et.Sub(st)
-
-// 	if c.res.Extensions == nil {
-// 		c.res.Extensions = &extensions{&trace{
-// 			Version:   1,
-// 			StartTime: st,
-// 			Execution: execution{},
-// 		}}
-// 	}
-
-// 	c.res.Extensions.Tracing.EndTime = et
-// 	c.res.Extensions.Tracing.Duration = du
-
-// 	n := 1
-// 	for i := id; i != -1; i = sel[i].ParentID {
-// 		n++
-// 	}
-// 	path := make([]string, n)
-
-// 	n--
-// 	for i := id; ; i = sel[i].ParentID {
-// 		path[n] = sel[i].Name
-// 		if sel[i].ParentID == -1 {
-// 			break
-// 		}
-// 		n--
-// 	}
-
-// 	tr := resolver{
-// 		Path:        path,
-// 		ParentType:  "Query",
-// 		FieldName:   sel[id].Name,
-// 		ReturnType:  "object",
-// 		StartOffset: 1,
-// 		Duration:    du,
-// 	}
-
-// 	c.res.Extensions.Tracing.Execution.Resolvers =
-// 		append(c.res.Extensions.Tracing.Execution.Resolvers, tr)
-// }
-
 func (c *gcontext) debugLog(st *stmt) {
 	for _, sel := range st.qc.Selects {
 		if sel.SkipRender == qcode.SkipTypeUserNeeded {
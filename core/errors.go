@@ -0,0 +1,165 @@
+package core
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dosco/graphjin/core/internal/graph"
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/jackc/pgconn"
+)
+
+// Error codes set as 'extensions.code' on errors
+const (
+	CodeNotInAllowList         = "NOT_IN_ALLOW_LIST"
+	CodePersistedQueryNotFound = "PERSISTED_QUERY_NOT_FOUND"
+	CodeParseFailed            = "GRAPHQL_PARSE_FAILED"
+	CodeValidationFailed       = "GRAPHQL_VALIDATION_FAILED"
+	CodeForbidden              = "FORBIDDEN"
+	CodeConstraintViolation    = "CONSTRAINT_VIOLATION"
+	CodeTooComplex             = "QUERY_TOO_COMPLEX"
+	CodeTimeout                = "TIMEOUT"
+	CodeRemoteJoinFailed       = "REMOTE_JOIN_FAILED"
+	CodeBatchRollback          = "BATCH_ROLLED_BACK"
+	CodeInternalServerError    = "INTERNAL_SERVER_ERROR"
+)
+
+const (
+	pgErrClassIntegrity         = "23"
+	pgErrInsufficientPrivileges = "42501"
+	pgErrQueryCanceled          = "57014"
+)
+
+// Error is a GraphQL error as defined by the spec. Use errors.Is with
+// ErrNotInAllowList, ErrPersistedQueryNotFound, ErrValidation,
+// ErrForbidden, ErrConstraintViolation, ErrRemoteJoin or ErrBatchRollback
+// to check the kind of error
+type Error struct {
+	Message    string           `json:"message"`
+	Locations  []Location       `json:"locations,omitempty"`
+	Path       []string         `json:"path,omitempty"`
+	Extensions *ErrorExtensions `json:"extensions,omitempty"`
+	kind       error
+	err        error
+}
+
+// ErrorExtensions contains the error code and other details of the error
+type ErrorExtensions struct {
+	Code       string `json:"code"`
+	Constraint string `json:"constraint,omitempty"`
+}
+
+// Location is the line and column in the query the error relates to
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && e.kind == target
+}
+
+// kindError marks an error as being of a kind like ErrValidation
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return e.kind == target
+}
+
+func validationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: ErrValidation, err: err}
+}
+
+// newError converts an error into a GraphQL error with the
+// location, path and error code set
+func newError(err error) Error {
+	e := Error{Message: err.Error(), err: err}
+	ext := ErrorExtensions{Code: CodeInternalServerError}
+
+	var pgErr *pgconn.PgError
+	var qErr *qcode.Error
+	var pErr *graph.ParseError
+
+	switch {
+	case errors.Is(err, qcode.ErrBlocked), errors.Is(err, ErrForbidden):
+		e.kind, ext.Code = ErrForbidden, CodeForbidden
+
+	case errors.Is(err, ErrTimeout):
+		e.kind, ext.Code = ErrTimeout, CodeTimeout
+
+	case errors.As(err, &pgErr):
+		switch {
+		case len(pgErr.Code) > 2 && pgErr.Code[:2] == pgErrClassIntegrity:
+			e.kind, ext.Code = ErrConstraintViolation, CodeConstraintViolation
+			ext.Constraint = pgErr.ConstraintName
+		case pgErr.Code == pgErrInsufficientPrivileges:
+			e.kind, ext.Code = ErrForbidden, CodeForbidden
+		case pgErr.Code == pgErrQueryCanceled &&
+			strings.Contains(pgErr.Message, "statement timeout"):
+			e.kind, ext.Code = ErrTimeout, CodeTimeout
+		}
+
+	case errors.Is(err, ErrRemoteJoin):
+		e.kind, ext.Code = ErrRemoteJoin, CodeRemoteJoinFailed
+
+	case errors.Is(err, ErrBatchRollback):
+		e.kind, ext.Code = ErrBatchRollback, CodeBatchRollback
+
+	case errors.Is(err, ErrNotInAllowList):
+		e.kind, ext.Code = ErrNotInAllowList, CodeNotInAllowList
+
+	case errors.Is(err, ErrPersistedQueryNotFound):
+		e.kind, ext.Code = ErrPersistedQueryNotFound, CodePersistedQueryNotFound
+
+	case errors.As(err, &pErr):
+		e.kind, ext.Code = ErrValidation, CodeParseFailed
+
+	case errors.Is(err, qcode.ErrTooComplex):
+		e.kind, ext.Code = ErrValidation, CodeTooComplex
+
+	case errors.Is(err, ErrValidation), errors.As(err, &qErr):
+		e.kind, ext.Code = ErrValidation, CodeValidationFailed
+	}
+
+	if errors.As(err, &qErr) {
+		e.Path = qErr.Path
+		if qErr.Loc.Line != 0 {
+			e.Locations = []Location{{Line: qErr.Loc.Line, Column: qErr.Loc.Column}}
+		}
+	} else if errors.As(err, &pErr) && pErr.Loc.Line != 0 {
+		e.Locations = []Location{{Line: pErr.Loc.Line, Column: pErr.Loc.Column}}
+	}
+
+	e.Extensions = &ext
+
+	return e
+}
+
+// setError sets the error on the result and returns it as an *Error
+func (r *Result) setError(err error) error {
+	e := newError(err)
+	r.Errors = []Error{e}
+	return &e
+}
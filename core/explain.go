@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/goccy/go-json"
+)
+
+// ExplainOpts are the options for the Explain function
+type ExplainOpts struct {
+	// Analyze executes the query to include the actual timings and
+	// row counts in the plan. The query is always run in a transaction
+	// that is rolled back so mutations do not change any data
+	Analyze bool
+
+	*ReqConfig
+}
+
+// ExplainResult contains the query plan along with the SQL
+// and the parameter values it was run with
+type ExplainResult struct {
+	Plan   json.RawMessage
+	SQL    string
+	Params []interface{}
+	Role   string
+}
+
+// Explain compiles the query the same way as the GraphQL function (roles,
+// allow list, variables) and returns the Postgres query plan from
+// `EXPLAIN (FORMAT JSON)`.
+func (g *GraphJin) Explain(
+	c context.Context,
+	query string,
+	vars json.RawMessage,
+	opts *ExplainOpts) (*ExplainResult, error) {
+
+	gj := g.Load().(*graphjin)
+
+	if gj.dbtype != "postgres" {
+		return nil, errors.New("explain: only supported with postgres")
+	}
+
+	if opts == nil {
+		opts = &ExplainOpts{}
+	}
+
+	ct := gcontext{
+		Context: c,
+		gj:      gj,
+		rc:      opts.ReqConfig,
+	}
+	ct.op, ct.name = qcode.GetQType(query)
+
+	if ct.op == qcode.QTSubscription {
+		e := newError(validationError(errors.New("explain: subscriptions not supported")))
+		return nil, &e
+	}
+
+	qr := queryReq{
+		op:    ct.op,
+		name:  ct.name,
+		query: []byte(query),
+		vars:  vars,
+	}
+
+	tx, err := gj.pool.Begin(c)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(c) //nolint: errcheck
+
+	qres, ar, err := ct.prepareSQL(tx, qr, userRole(c))
+	if err != nil {
+		e := newError(err)
+		return nil, &e
+	}
+
+	sql := qres.qc.st.sql
+	ex := "EXPLAIN (FORMAT JSON) "
+
+	if opts.Analyze {
+		ex = "EXPLAIN (ANALYZE, FORMAT JSON) "
+	}
+
+	var plan []byte
+
+	if err := tx.QueryRow(c, ex+sql, ar.values...).Scan(&plan); err != nil {
+		return nil, err
+	}
+
+	res := &ExplainResult{
+		Plan:   plan,
+		SQL:    sql,
+		Params: ar.values,
+		Role:   qres.role,
+	}
+	return res, nil
+}
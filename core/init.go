@@ -306,6 +306,8 @@ func addForeignKey(conf *Config, di *sdata.DBInfo, c Column, t Table) error {
 
 func addRoles(c *Config, qc *qcode.Compiler) error {
 	for _, r := range c.Roles {
+		qc.SetRoleLimits(r.Name, qcode.Limits(r.Limits))
+
 		for _, t := range r.Tables {
 			if err := addRole(qc, r, t, c.DefaultBlock); err != nil {
 				return err
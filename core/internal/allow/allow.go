@@ -83,6 +83,32 @@ func (al *List) Load() ([]Item, error) {
 	return items, nil
 }
 
+// Fingerprint returns a value that changes when a file in the queries
+// or fragments directories is added, removed or modified
+func (al *List) Fingerprint() (string, error) {
+	var sb strings.Builder
+
+	for _, p := range []string{queryPath, fragmentPath} {
+		files, err := os.ReadDir(path.Join(al.dir, p))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("allow list: %w", err)
+		}
+
+		for _, f := range files {
+			fi, err := f.Info()
+			if err != nil {
+				return "", fmt.Errorf("allow list: %w", err)
+			}
+			fmt.Fprintf(&sb, "%s/%s:%d:%d;", p, fi.Name(), fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+
+	return sb.String(), nil
+}
+
 func parseQuery(b string) (Item, error) {
 	var s scanner.Scanner
 	s.Init(strings.NewReader(b))
@@ -1,6 +1,8 @@
 package allow
 
 import (
+	"os"
+	"path"
 	"testing"
 )
 
@@ -239,3 +241,42 @@ func TestParse2(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	qd := path.Join(dir, "queries")
+
+	if err := os.Mkdir(qd, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	al := New(dir)
+
+	fp1, err := al.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path.Join(qd, "getUsers.yaml"), []byte("name: getUsers"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp2, err := al.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fp1 == fp2 {
+		t.Fatal("fingerprint should change when a file is added")
+	}
+
+	fp3, err := al.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fp2 != fp3 {
+		t.Fatal("fingerprint should not change when files are unchanged")
+	}
+}
@@ -35,6 +35,7 @@ type item struct {
 	pos   Pos    // The starting position, in bytes, of this item in the input string.
 	val   []byte // The value of this item.
 	line  int16  // The line number at the start of this item.
+	col   int32  // The column number at the start of this item.
 }
 
 // MType identifies the type of lex items.
@@ -88,6 +89,8 @@ type lexer struct {
 	items  []item // array of scanned items
 	itemsA [50]item
 	line   int16 // 1+number of newlines seen
+	ls     Pos   // start position of the current line
+	pls    Pos   // start position of the previous line
 	err    error
 }
 
@@ -108,6 +111,8 @@ func (l *lexer) next() rune {
 	l.pos += l.width
 	if r == '\n' {
 		l.line++
+		l.pls = l.ls
+		l.ls = l.pos
 	}
 	return r
 }
@@ -126,17 +131,26 @@ func (l *lexer) backup() {
 		// Correct newline count.
 		if l.width == 1 && l.input[l.pos] == '\n' {
 			l.line--
+			l.ls = l.pls
 		}
 	}
 }
 
+// col returns the column of the start position of the current item
+func (l *lexer) col() int32 {
+	if l.start < l.ls {
+		return 1
+	}
+	return int32(l.start-l.ls) + 1
+}
+
 func (l *lexer) current() []byte {
 	return l.input[l.start:l.pos]
 }
 
 // emit passes an item back to the client.
 func (l *lexer) emit(t MType) {
-	l.items = append(l.items, item{t, l.start, l.current(), l.line})
+	l.items = append(l.items, item{t, l.start, l.current(), l.line, l.col()})
 	// Some items contain text internally. If so, count their newlines.
 	if t == itemStringVal {
 		for i := l.start; i < l.pos; i++ {
@@ -198,7 +212,7 @@ func (l *lexer) acceptRun(valid []byte) {
 // back a nil pointer that will be the next state, terminating l.nextItem.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
 	l.err = fmt.Errorf(format, args...)
-	l.items = append(l.items, item{itemError, l.start, l.input[l.start:l.pos], l.line})
+	l.items = append(l.items, item{itemError, l.start, l.input[l.start:l.pos], l.line, l.col()})
 	return nil
 }
 
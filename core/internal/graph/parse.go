@@ -14,8 +14,9 @@ var (
 )
 
 const (
-	maxFields = 1200
-	maxArgs   = 25
+	maxFields    = 1200
+	maxArgs      = 25
+	maxFragDepth = 10
 )
 
 type ParserType int8
@@ -69,6 +70,28 @@ type Field struct {
 	Directives []Directive
 	Children   []int32
 	childrenA  [5]int32
+	Loc        Location
+}
+
+// Location is the line and column of a token in the query
+type Location struct {
+	Line   int
+	Column int
+}
+
+// ParseError is an error in parsing the query along
+// with the location where it happened
+type ParseError struct {
+	Loc Location
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
 }
 
 type Arg struct {
@@ -110,7 +133,12 @@ type Parser struct {
 	pos       int
 	items     []item
 	json      bool
-	err       error
+	fdepth    int
+	// start and end positions of the fragments defined in the
+	// document, set when a fragment is used before it's defined
+	fpos map[string]int
+	fend map[int]int
+	err  error
 }
 
 func Parse(gql []byte, fetchFrag func(name string) (string, error)) (Operation, error) {
@@ -123,7 +151,8 @@ func Parse(gql []byte, fetchFrag func(name string) (string, error)) (Operation,
 	}
 
 	if l, err = lex(gql); err != nil {
-		return op, err
+		it := l.items[len(l.items)-1]
+		return op, &ParseError{Loc: Location{Line: int(it.line), Column: int(it.col)}, Err: err}
 	}
 
 	p := Parser{
@@ -145,8 +174,14 @@ func Parse(gql []byte, fetchFrag func(name string) (string, error)) (Operation,
 
 		if p.peekVal(fragmentToken) && p.fetchFrag == nil {
 			p.ignore()
+
+			// skip fragments already parsed when they were used
+			if end, ok := p.fend[p.pos]; ok {
+				p.reset(end)
+				continue
+			}
 			if _, err := p.parseFragment(); err != nil {
-				return op, err
+				return op, p.parseError(err)
 			}
 
 		} else {
@@ -162,7 +197,7 @@ func Parse(gql []byte, fetchFrag func(name string) (string, error)) (Operation,
 
 	p.reset(s)
 	if op, err = p.parseOp(); err != nil {
-		return op, err
+		return op, p.parseError(err)
 	}
 
 	for i, f := range op.Fields {
@@ -173,6 +208,23 @@ func Parse(gql []byte, fetchFrag func(name string) (string, error)) (Operation,
 	return op, nil
 }
 
+// parseError adds the location of the current token to the error
+func (p *Parser) parseError(err error) error {
+	var it item
+
+	switch {
+	case len(p.items) == 0:
+		return err
+	case p.pos < 0:
+		it = p.items[0]
+	case p.pos >= len(p.items):
+		it = p.items[len(p.items)-1]
+	default:
+		it = p.items[p.pos]
+	}
+	return &ParseError{Loc: Location{Line: int(it.line), Column: int(it.col)}, Err: err}
+}
+
 func (p *Parser) parseFragment() (Fragment, error) {
 	var err error
 	var frag Fragment
@@ -449,6 +501,11 @@ func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error)
 		name := p.val(p.next())
 
 		fr, ok = p.frags[name]
+		if !ok && p.fetchFrag == nil {
+			if fr, ok, err = p.parseFragmentAhead(name); err != nil {
+				return nil, err
+			}
+		}
 		if !ok {
 			if p.fetchFrag != nil {
 				fval, err := p.fetchFrag(name)
@@ -508,9 +565,58 @@ func (p *Parser) parseFragmentFields(st *Stack, fields []Field) ([]Field, error)
 	return fields, nil
 }
 
+// parseFragmentAhead parses a fragment that is defined further down in
+// the document, this is needed since fragments can be used before they
+// are defined (eg. the standard introspection query). The parsed fragment
+// is added to the fragments and skipped when reached in the document
+func (p *Parser) parseFragmentAhead(name string) (Fragment, bool, error) {
+	var fr Fragment
+	var err error
+
+	if p.fdepth >= maxFragDepth {
+		return fr, false, fmt.Errorf("fragment: too deeply nested: %s", name)
+	}
+
+	if p.fpos == nil {
+		p.indexFragments()
+	}
+
+	i, ok := p.fpos[name]
+	if !ok {
+		return fr, false, nil
+	}
+
+	pos := p.pos
+	p.pos = i
+	p.fdepth++
+	fr, err = p.parseFragment()
+	p.fdepth--
+	p.fend[i] = p.pos
+	p.pos = pos
+
+	return fr, (err == nil), err
+}
+
+// indexFragments sets the positions of all the
+// fragments defined in the document
+func (p *Parser) indexFragments() {
+	p.fpos = make(map[string]int)
+	p.fend = make(map[int]int)
+
+	for i := 0; i < len(p.items)-2; i++ {
+		if p.items[i]._type == itemName &&
+			bytes.EqualFold(p.items[i].val, fragmentToken) &&
+			p.items[i+1]._type == itemName &&
+			p.items[i+2]._type == itemOn {
+			p.fpos[p.val(p.items[i+1])] = i
+		}
+	}
+}
+
 func (p *Parser) parseField(f *Field) error {
 	var err error
 	v := p.next()
+	f.Loc = Location{Line: int(v.line), Column: int(v.col)}
 
 	if p.peek(itemColon) {
 		p.ignore()
@@ -87,7 +87,9 @@ func (c *compilerContext) renderUpdateStmt(m qcode.Mutate) {
 		c.colWithTable(("_x_" + rel.Right.Col.Table), rel.Right.Col.Name)
 		c.w.WriteString(`)`)
 
-		if m.Rel.Type == sdata.RelOneToOne {
+		// one-to-many updates only have a filter when the
+		// table has a tenant column
+		if m.Rel.Type == sdata.RelOneToOne || m.Where.Exp != nil {
 			c.w.WriteString(` AND `)
 			c.renderExpPath(m.Ti, m.Where.Exp, false, append(m.Path, "where"))
 		}
@@ -44,6 +44,13 @@ func (co *Compiler) compileChildColumns(
 	field graph.Field,
 	tr trval) error {
 
+	// these are all remote fields we use
+	// these later to filter the response json
+	if sel.Rel.Type == sdata.RelRemote {
+		sel.RemoteFields = remoteFields(op, field.Children)
+		return nil
+	}
+
 	aggExist := false
 
 	for _, cid := range field.Children {
@@ -63,13 +70,6 @@ func (co *Compiler) compileChildColumns(
 			fname = f.Name
 		}
 
-		// these are all remote fields we use
-		// these later to strip the response json
-		if sel.Rel.Type == sdata.RelRemote {
-			sel.Cols = append(sel.Cols, Column{FieldName: fname})
-			continue
-		}
-
 		if len(f.Children) != 0 {
 			val := f.ID | (sel.ID << 16)
 			st.Push(val)
@@ -90,11 +90,12 @@ func (co *Compiler) compileChildColumns(
 			if err == nil {
 				sel.addCol(Column{Col: dbc, FieldName: fname}, false)
 			} else {
-				return err
+				return &Error{Path: []string{fname}, Loc: f.Loc, Err: err}
 			}
 			if dbc.Blocked {
-				return fmt.Errorf("column: '%s.%s.%s' blocked",
-					dbc.Schema, dbc.Table, dbc.Name)
+				return &Error{Path: []string{fname}, Loc: f.Loc,
+					Err: errBlocked("column: '%s.%s.%s' blocked",
+						dbc.Schema, dbc.Table, dbc.Name)}
 			}
 			// is a function
 		} else {
@@ -202,12 +203,12 @@ func (co *Compiler) orderByIDCol(sel *Select) error {
 func validateSelector(qc *QCode, sel *Select, tr trval) error {
 	for _, col := range sel.Cols {
 		if !tr.columnAllowed(qc, col.Col.Name) {
-			return fmt.Errorf("column blocked: %s (%s)", col.Col.Name, tr.role)
+			return errBlocked("column blocked: %s (%s)", col.Col.Name, tr.role)
 		}
 	}
 
 	if len(sel.Funcs) != 0 && tr.isFuncsBlocked() {
-		return fmt.Errorf("functions blocked: %s (%s)", sel.Funcs[0].Col.Name, tr.role)
+		return errBlocked("functions blocked: %s (%s)", sel.Funcs[0].Col.Name, tr.role)
 	}
 
 	for _, fn := range sel.Funcs {
@@ -220,7 +221,7 @@ func validateSelector(qc *QCode, sel *Select, tr trval) error {
 		}
 
 		if blocked {
-			return fmt.Errorf("column blocked: %s (%s)", fn.Name, tr.role)
+			return errBlocked("column blocked: %s (%s)", fn.Name, tr.role)
 		}
 	}
 	return nil
@@ -14,6 +14,8 @@ type Config struct {
 	DisableFuncs     bool
 	EnableCamelcase  bool
 	DBSchema         string
+	Limits           Limits
+	TenantColumn     string
 	defTrv           trval
 }
 
@@ -207,8 +209,32 @@ func (trv *trval) filter(qt QType) (*Exp, bool) {
 	return nil, false
 }
 
-func (trv *trval) columnAllowed(qt *QCode, name string) bool {
-	switch qt.SType {
+// IsBlocked returns true if the operation type is blocked on the
+// table for the role
+func (co *Compiler) IsBlocked(role, schema, table string, qt QType) bool {
+	if schema == "" {
+		schema = co.s.DBSchema()
+	}
+	tr := co.getRole(role, schema, table, table)
+	return tr.isBlocked(qt)
+}
+
+// IsColumnAllowed returns true if the role is allowed to use the column
+// with the operation type on the table
+func (co *Compiler) IsColumnAllowed(role, schema, table string, qt QType, col string) bool {
+	if schema == "" {
+		schema = co.s.DBSchema()
+	}
+	tr := co.getRole(role, schema, table, table)
+	return tr.colAllowed(qt, col)
+}
+
+func (trv *trval) columnAllowed(qc *QCode, name string) bool {
+	return trv.colAllowed(qc.SType, name)
+}
+
+func (trv *trval) colAllowed(qt QType, name string) bool {
+	switch qt {
 	case QTQuery:
 		_, ok := trv.query.cols[name]
 		return ok || len(trv.query.cols) == 0
@@ -1,11 +1,73 @@
 package qcode
 
 import (
+	"errors"
 	"fmt"
 
+	"github.com/dosco/graphjin/core/internal/graph"
 	"github.com/dosco/graphjin/core/internal/sdata"
 )
 
+// ErrBlocked matches errors caused by a table, column or
+// operation being blocked by the config or role
+var ErrBlocked = errors.New("blocked")
+
+// Error is an error in compiling a field along with the path
+// to the field and its location in the query
+type Error struct {
+	Path []string
+	Loc  graph.Location
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type blockedError struct {
+	error
+}
+
+func (e blockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+func (e blockedError) Unwrap() error {
+	return e.error
+}
+
+func errBlocked(format string, a ...interface{}) error {
+	return blockedError{fmt.Errorf(format, a...)}
+}
+
+// fieldError adds the path to the selector and the location
+// of its field in the query to the error. Errors with a path
+// relative to the selector (eg. columns) get the selector path prefixed
+func fieldError(qc *QCode, sel *Select, field graph.Field, err error) error {
+	path := selPath(qc, sel)
+
+	if e, ok := err.(*Error); ok {
+		return &Error{Path: append(path, e.Path...), Loc: e.Loc, Err: e.Err}
+	}
+	return &Error{Path: path, Loc: field.Loc, Err: err}
+}
+
+// selPath returns the path of field names from the root to the selector
+func selPath(qc *QCode, sel *Select) []string {
+	path := []string{sel.FieldName}
+
+	for pid := sel.ParentID; pid != -1; {
+		psel := &qc.Selects[pid]
+		path = append([]string{psel.FieldName}, path...)
+		pid = psel.ParentID
+	}
+	return path
+}
+
 func graphError(err error, from, to, through string) error {
 	switch err {
 	case sdata.ErrFromEdgeNotFound:
@@ -0,0 +1,140 @@
+package qcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooComplex matches errors caused by a query going over
+// one of the complexity limits
+var ErrTooComplex = errors.New("query too complex")
+
+// Limits are the complexity limits a query must be within, a value
+// of zero means no limit
+type Limits struct {
+	// MaxDepth is the max nesting depth of the selections
+	MaxDepth int
+	// MaxSelects is the max number of selections (tables) in the query
+	MaxSelects int
+	// MaxLimit is the max limit (number of rows) allowed on a selection
+	MaxLimit int
+	// MaxCost is the max estimated number of rows returned. Computed by
+	// multiplying the limits down each path of the selection tree
+	MaxCost int
+}
+
+// merge returns the limits with the non-zero values of l1 overriding l
+func (l Limits) merge(l1 Limits) Limits {
+	if l1.MaxDepth != 0 {
+		l.MaxDepth = l1.MaxDepth
+	}
+	if l1.MaxSelects != 0 {
+		l.MaxSelects = l1.MaxSelects
+	}
+	if l1.MaxLimit != 0 {
+		l.MaxLimit = l1.MaxLimit
+	}
+	if l1.MaxCost != 0 {
+		l.MaxCost = l1.MaxCost
+	}
+	return l
+}
+
+// SetRoleLimits sets the complexity limits for a role, non-zero
+// values override the ones set in the config
+func (co *Compiler) SetRoleLimits(role string, l Limits) {
+	co.rl[role] = l
+}
+
+type complexityError struct {
+	error
+}
+
+func (e complexityError) Is(target error) bool {
+	return target == ErrTooComplex
+}
+
+func (e complexityError) Unwrap() error {
+	return e.error
+}
+
+func errTooComplex(format string, a ...interface{}) error {
+	return complexityError{fmt.Errorf(format, a...)}
+}
+
+func (co *Compiler) validateLimits(qc *QCode, role string) error {
+	l := co.c.Limits
+
+	if rl, ok := co.rl[role]; ok {
+		l = l.merge(rl)
+	}
+
+	if l == (Limits{}) {
+		return nil
+	}
+
+	if l.MaxSelects != 0 && len(qc.Selects) > l.MaxSelects {
+		return errTooComplex("query has %d selections, max allowed is %d",
+			len(qc.Selects), l.MaxSelects)
+	}
+
+	// selects are always added after their parent so the
+	// depth and rows of the parent are known
+	depth := make([]int, len(qc.Selects))
+	rows := make([]int64, len(qc.Selects))
+
+	var cost int64
+
+	for i := range qc.Selects {
+		sel := &qc.Selects[i]
+
+		limit := int64(sel.Paging.Limit)
+		if sel.Singular {
+			limit = 1
+		}
+
+		if l.MaxLimit != 0 && limit > int64(l.MaxLimit) {
+			return &Error{Path: selPath(qc, sel),
+				Err: errTooComplex("limit of %d on '%s' is over the max allowed of %d",
+					limit, sel.FieldName, l.MaxLimit)}
+		}
+
+		// the value of a limit variable is only known when the query is run
+		if l.MaxLimit != 0 && sel.Paging.LimitVar != "" && !sel.Singular {
+			if qc.LimitVars == nil {
+				qc.LimitVars = make(map[string]int32)
+			}
+			qc.LimitVars[sel.Paging.LimitVar] = int32(l.MaxLimit)
+		}
+
+		if sel.ParentID == -1 {
+			depth[i], rows[i] = 1, limit
+		} else {
+			depth[i] = depth[sel.ParentID] + 1
+			rows[i] = rows[sel.ParentID] * limit
+		}
+
+		if l.MaxDepth != 0 && depth[i] > l.MaxDepth {
+			return &Error{Path: selPath(qc, sel),
+				Err: errTooComplex("query depth of %d is over the max allowed of %d",
+					depth[i], l.MaxDepth)}
+		}
+
+		if cost += rows[i]; l.MaxCost != 0 && cost > int64(l.MaxCost) {
+			return errTooComplex("query cost is over the max allowed of %d", l.MaxCost)
+		}
+	}
+
+	return nil
+}
+
+// ValidateLimitVar returns an error if the value of the limit
+// variable is over the max limit allowed
+func (qc *QCode) ValidateLimitVar(name string, val int64) error {
+	max, ok := qc.LimitVars[name]
+	if !ok || val <= int64(max) {
+		return nil
+	}
+	return errTooComplex("limit of %d in variable '%s' is over the max allowed of %d",
+		val, name, max)
+}
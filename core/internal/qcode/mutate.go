@@ -278,6 +278,13 @@ func (co *Compiler) newMutate(ms *mState, m Mutate, role string) error {
 			return err
 		}
 
+		// inserts are not filtered the tenant column is preset instead
+		if m1.Type != MTInsert {
+			if fil := co.tenantFilter(m1.Ti); fil != nil {
+				setFilter(&m1.Where, fil)
+			}
+		}
+
 		items = append(items, m1)
 		m.children = append(m.children, m1.ID)
 		ms.id++
@@ -465,9 +472,26 @@ func (co *Compiler) addTablesAndColumns(m *Mutate, items []Mutate, trv trval) er
 		}
 	}
 
-	if m.Cols, err = getColumnsFromJSON(m, trv, cm); err != nil {
+	// the tenant column is always set to the tenant of the request and takes
+	// priority over relationships (eg. connect), role presets and the json data
+	if col, ok := co.tenantColumn(m.Ti); ok &&
+		(m.Type == MTInsert || m.Type == MTUpdate || m.Type == MTUpsert) {
+		rcols := m.RCols[:0]
+		for _, rc := range m.RCols {
+			if rc.Col.Name != col.Name {
+				rcols = append(rcols, rc)
+			}
+		}
+		m.RCols = rcols
+		m.Cols = append(m.Cols, MColumn{Col: col, FieldName: col.Name, Value: "$" + tenantVar})
+		cm[col.Name] = struct{}{}
+	}
+
+	cols, err := getColumnsFromJSON(m, trv, cm)
+	if err != nil {
 		return err
 	}
+	m.Cols = append(m.Cols, cols...)
 
 	return nil
 }
@@ -501,7 +525,7 @@ func getColumnsFromJSON(m *Mutate, trv trval, cm map[string]struct{}) ([]MColumn
 		}
 
 		if m.Ti.Blocked {
-			return nil, fmt.Errorf("column blocked: %s", k)
+			return nil, errBlocked("column blocked: %s", k)
 		}
 
 		cols = append(cols, MColumn{Col: m.Ti.Columns[i], FieldName: k})
@@ -69,6 +69,9 @@ type QCode struct {
 	Script    string
 	Metadata  allow.Metadata
 	Cache     Cache
+	// LimitVars are the max values allowed for the limit
+	// variables, checked when the query is run
+	LimitVars map[string]int32
 }
 
 type Select struct {
@@ -93,9 +96,13 @@ type Select struct {
 	Ti         sdata.DBTable
 	Rel        sdata.DBRel
 	Joins      []Join
-	order      Order
-	through    string
-	tc         TConfig
+	// RemoteFields and RemoteArgs are the selected fields and
+	// arguments of a remote field
+	RemoteFields []RemoteField
+	RemoteArgs   map[string]interface{}
+	order        Order
+	through      string
+	tc           TConfig
 }
 
 type TableInfo struct {
@@ -179,6 +186,10 @@ type Paging struct {
 
 type Cache struct {
 	Header string
+	// MaxAge is the max age (in seconds) from @cacheControl
+	MaxAge int
+	// Scope is the scope from @cacheControl (eg. public or private)
+	Scope string
 }
 
 type ExpOp int8
@@ -262,6 +273,7 @@ type Compiler struct {
 	c  Config
 	s  *sdata.DBSchema
 	tr map[string]trval
+	rl map[string]Limits
 }
 
 func NewCompiler(s *sdata.DBSchema, c Config) (*Compiler, error) {
@@ -275,18 +287,32 @@ func NewCompiler(s *sdata.DBSchema, c Config) (*Compiler, error) {
 	c.defTrv.upsert.block = c.DefaultBlock
 	c.defTrv.delete.block = c.DefaultBlock
 
-	return &Compiler{c: c, s: s, tr: make(map[string]trval)}, nil
+	return &Compiler{
+		c:  c,
+		s:  s,
+		tr: make(map[string]trval),
+		rl: make(map[string]Limits),
+	}, nil
 }
 
 type Variables map[string]json.RawMessage
 
 func (co *Compiler) Compile(query []byte, vars Variables, role string) (*QCode, error) {
-	var err error
-
-	op, err := graph.Parse(query, co.c.FragmentFetcher)
+	op, err := co.Parse(query)
 	if err != nil {
 		return nil, err
 	}
+	return co.CompileOp(&op, vars, role)
+}
+
+// Parse parses the query into a GraphQL operation
+func (co *Compiler) Parse(query []byte) (graph.Operation, error) {
+	return graph.Parse(query, co.c.FragmentFetcher)
+}
+
+// CompileOp compiles a parsed GraphQL operation
+func (co *Compiler) CompileOp(op *graph.Operation, vars Variables, role string) (*QCode, error) {
+	var err error
 
 	qc := QCode{Name: op.Name, SType: QTQuery, Schema: co.s, Vars: vars}
 	qc.Roots = qc.rootsA[:0]
@@ -302,16 +328,20 @@ func (co *Compiler) Compile(query []byte, vars Variables, role string) (*QCode,
 		return nil, fmt.Errorf("invalid operation: %s", op.Type)
 	}
 
-	if err := co.compileQuery(&qc, &op, role); err != nil {
+	if err := co.compileQuery(&qc, op, role); err != nil {
 		return nil, err
 	}
 
 	if qc.Type == QTMutation {
-		if err = co.compileMutation(&qc, &op, role); err != nil {
+		if err = co.compileMutation(&qc, op, role); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := co.validateLimits(&qc, role); err != nil {
+		return nil, err
+	}
+
 	return &qc, nil
 }
 
@@ -393,26 +423,26 @@ func (co *Compiler) compileQuery(qc *QCode, op *graph.Operation, role string) er
 		sel.Children = make([]int32, 0, 5)
 
 		if err := co.compileDirectives(qc, sel, field.Directives); err != nil {
-			return err
+			return fieldError(qc, sel, field, err)
 		}
 
 		if err := co.addRelInfo(op, qc, sel, field); err != nil {
-			return err
+			return fieldError(qc, sel, field, err)
 		}
 
 		tr, err := co.setSelectorRole(role, field.Name, qc, sel)
 		if err != nil {
-			return err
+			return fieldError(qc, sel, field, err)
 		}
 
 		co.setLimit(tr, qc, sel)
 
 		if err := co.compileArgs(qc, sel, field.Args, role); err != nil {
-			return err
+			return fieldError(qc, sel, field, err)
 		}
 
 		if err := co.compileColumns(st, op, qc, sel, field, tr); err != nil {
-			return err
+			return fieldError(qc, sel, field, err)
 		}
 
 		// Order is important AddFilters must come after compileArgs
@@ -420,12 +450,16 @@ func (co *Compiler) compileQuery(qc *QCode, op *graph.Operation, role string) er
 			sel.SkipRender = SkipTypeUserNeeded
 		}
 
+		if fil := co.tenantFilter(sel.Ti); fil != nil {
+			setFilter(&sel.Where, fil)
+		}
+
 		// If an actual cursor is available
 		if sel.Paging.Cursor {
 			// Set tie-breaker order column for the cursor direction
 			// this column needs to be the last in the order series.
 			if err := co.orderByIDCol(sel); err != nil {
-				return err
+				return fieldError(qc, sel, field, err)
 			}
 
 			// Set filter chain needed to make the cursor work
@@ -439,7 +473,7 @@ func (co *Compiler) compileQuery(qc *QCode, op *graph.Operation, role string) er
 		co.setRelFilters(qc, sel)
 
 		if err := co.validateSelect(sel); err != nil {
-			return err
+			return fieldError(qc, sel, field, err)
 		}
 
 		qc.Selects = append(qc.Selects, s1)
@@ -538,7 +572,7 @@ func (co *Compiler) addRelInfo(
 	}
 
 	if sel.Ti.Blocked {
-		return fmt.Errorf("table: '%t' (%s) blocked", sel.Ti.Blocked, field.Name)
+		return errBlocked("table: '%t' (%s) blocked", sel.Ti.Blocked, field.Name)
 	}
 
 	sel.Table = sel.Ti.Name
@@ -737,7 +771,7 @@ func (co *Compiler) setSelectorRole(role, fieldName string, qc *QCode, sel *Sele
 
 	if tr.isBlocked(qc.SType) {
 		if qc.SType != QTQuery {
-			return tr, fmt.Errorf("%s blocked: %s (role: %s)", qc.SType, fieldName, role)
+			return tr, errBlocked("%s blocked: %s (role: %s)", qc.SType, fieldName, role)
 		}
 		sel.SkipRender = SkipTypeUserNeeded
 	}
@@ -895,6 +929,11 @@ func (co *Compiler) compileDirectives(qc *QCode, sel *Select, dirs []graph.Direc
 func (co *Compiler) compileArgs(qc *QCode, sel *Select, args []graph.Arg, role string) error {
 	var err error
 
+	// arguments on remote fields are passed to the resolver
+	if sel.Rel.Type == sdata.RelRemote {
+		return co.compileRemoteArgs(sel, args)
+	}
+
 	for i := range args {
 		arg := &args[i]
 
@@ -1039,6 +1078,11 @@ func (co *Compiler) compileDirectiveCacheControl(qc *QCode, d *graph.Directive)
 		return fmt.Errorf("@cacheControl: required argument 'maxAge' missing")
 	}
 
+	n, err := strconv.Atoi(maxAge)
+	if err != nil {
+		return argErr("maxAge", "integer")
+	}
+
 	hdr := []string{"max-age=" + maxAge}
 
 	if scope != "" {
@@ -1046,6 +1090,8 @@ func (co *Compiler) compileDirectiveCacheControl(qc *QCode, d *graph.Directive)
 	}
 
 	qc.Cache.Header = strings.Join(hdr, " ")
+	qc.Cache.MaxAge = n
+	qc.Cache.Scope = scope
 	return nil
 }
 
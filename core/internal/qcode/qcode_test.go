@@ -2,6 +2,7 @@ package qcode_test
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/dosco/graphjin/core/internal/qcode"
@@ -92,6 +93,118 @@ func TestCompile3(t *testing.T) {
 	}
 }
 
+func TestCompileErrorPath(t *testing.T) {
+	qc, _ := qcode.NewCompiler(dbs, qcode.Config{})
+	err := qc.AddRole("user", "public", "users", qcode.TRConfig{
+		Query: qcode.QueryConfig{
+			Columns: []string{"id"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		path    string
+		line    int
+		column  int
+		blocked bool
+	}{
+		{"blocked", `query {
+	products {
+		id
+		owner: user {
+			email
+		}
+	}
+}`, "products.owner", 4, 3, true},
+		{"unknown_column", `query {
+	products {
+		id
+		owner: user {
+			id
+			emailx
+		}
+	}
+}`, "products.owner.emailx", 6, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := qc.Compile([]byte(tt.query), nil, "user")
+
+			var qErr *qcode.Error
+			if !errors.As(err, &qErr) {
+				t.Fatalf("expected a qcode.Error got: %v", err)
+			}
+
+			if errors.Is(err, qcode.ErrBlocked) != tt.blocked {
+				t.Fatalf("expected blocked to be %t: %v", tt.blocked, err)
+			}
+
+			if path := strings.Join(qErr.Path, "."); path != tt.path {
+				t.Fatalf("expected path '%s' got '%s'", tt.path, path)
+			}
+
+			if qErr.Loc.Line != tt.line || qErr.Loc.Column != tt.column {
+				t.Fatalf("expected location %d:%d got %d:%d",
+					tt.line, tt.column, qErr.Loc.Line, qErr.Loc.Column)
+			}
+		})
+	}
+}
+
+func TestCompileLimits(t *testing.T) {
+	qc, _ := qcode.NewCompiler(dbs, qcode.Config{
+		Limits: qcode.Limits{MaxDepth: 2, MaxSelects: 3, MaxLimit: 100, MaxCost: 1000},
+	})
+	qc.SetRoleLimits("admin", qcode.Limits{MaxDepth: 3, MaxCost: 10000})
+
+	tests := []struct {
+		name  string
+		query string
+		role  string
+		ok    bool
+	}{
+		{"ok", `query { products(limit: 10) { id user { id } } }`, "user", true},
+		{"depth", `query { products(limit: 1) { id user { id products { id } } } }`, "user", false},
+		{"depth_role", `query { products(limit: 1) { id user { id products { id } } } }`, "admin", true},
+		{"selects", `query { products(limit: 1) { id user { id } } users(limit: 1) { id } purchases(limit: 1) { id } }`, "user", false},
+		{"limit", `query { products(limit: 200) { id } }`, "user", false},
+		{"cost", `query { products(limit: 10) { id user { id } customer(limit: 10) { id } } }`, "user", true},
+		{"cost_over", `query { products(limit: 50) { id customer(limit: 50) { id } } }`, "user", false},
+		{"cost_role", `query { products(limit: 50) { id customer(limit: 50) { id } } }`, "admin", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := qc.Compile([]byte(tt.query), nil, tt.role)
+
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && !errors.Is(err, qcode.ErrTooComplex) {
+				t.Fatalf("expected a too complex error got: %v", err)
+			}
+		})
+	}
+
+	t.Run("limit_var", func(t *testing.T) {
+		q, err := qc.Compile([]byte(`query { products(limit: $n) { id } }`), nil, "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.ValidateLimitVar("n", 100); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.ValidateLimitVar("n", 1000000); !errors.Is(err, qcode.ErrTooComplex) {
+			t.Fatalf("expected a too complex error got: %v", err)
+		}
+	})
+}
+
 func TestInvalidCompile1(t *testing.T) {
 	qcompile, _ := qcode.NewCompiler(dbs, qcode.Config{})
 	_, err := qcompile.Compile([]byte(`#`), nil, "user")
@@ -235,6 +348,39 @@ func TestFragmentsCompile3(t *testing.T) {
 	}
 }
 
+func TestFragmentsCompile4(t *testing.T) {
+	gql := `
+	query {
+		users {
+			...userFields1
+			products {
+				id
+				user {
+					...userFields1
+				}
+			}
+		}
+	}
+
+	fragment userFields1 on user {
+		id
+		email
+	}`
+	qcompile, _ := qcode.NewCompiler(dbs, qcode.Config{})
+	qc, err := qcompile.Compile([]byte(gql), nil, "user")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []int{0, 2} {
+		sel := qc.Selects[id]
+		if len(sel.Cols) != 2 || sel.Cols[0].FieldName != "id" || sel.Cols[1].FieldName != "email" {
+			t.Fatalf("%s: expecting columns from the fragment: %v", sel.FieldName, sel.Cols)
+		}
+	}
+}
+
 var gql = []byte(`
 	{products(
 		# returns only 30 items
@@ -323,3 +469,71 @@ func BenchmarkQCompileFragment(b *testing.B) {
 		}
 	}
 }
+
+func TestCompileTenantColumn(t *testing.T) {
+	qc, _ := qcode.NewCompiler(dbs, qcode.Config{TenantColumn: "product_id"})
+
+	hasTenantFilter := func(ex *qcode.Exp) bool {
+		st := []*qcode.Exp{ex}
+		for len(st) != 0 {
+			ex, st = st[len(st)-1], st[:len(st)-1]
+			if ex == nil {
+				continue
+			}
+			if ex.Right.ValType == qcode.ValVar && ex.Right.Val == "__tenant_id" &&
+				ex.Left.Col.Name == "product_id" {
+				return true
+			}
+			st = append(st, ex.Children...)
+		}
+		return false
+	}
+
+	res, err := qc.Compile([]byte(`query {
+		products {
+			id
+			purchases {
+				id
+			}
+			user {
+				id
+			}
+		}
+	}`), nil, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sel := range res.Selects {
+		_, err := sel.Ti.GetColumn("product_id")
+		if hasCol := err == nil; hasCol != hasTenantFilter(sel.Where.Exp) {
+			t.Fatalf("%s: expected tenant filter %t", sel.Table, hasCol)
+		}
+	}
+
+	vars := map[string]json.RawMessage{
+		"data": json.RawMessage(`{ "id": 1, "product_id": 5, "quantity": 2 }`),
+	}
+
+	res, err = qc.Compile([]byte(`mutation {
+		purchases(insert: $data) {
+			id
+		}
+	}`), vars, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var preset bool
+	for _, col := range res.Mutates[0].Cols {
+		if col.Col.Name == "product_id" {
+			if col.Value != "$__tenant_id" {
+				t.Fatalf("expected tenant column preset got: %s", col.Value)
+			}
+			preset = true
+		}
+	}
+	if !preset {
+		t.Fatal("expected tenant column preset")
+	}
+}
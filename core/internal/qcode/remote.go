@@ -0,0 +1,103 @@
+package qcode
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/dosco/graphjin/core/internal/graph"
+)
+
+// RemoteField is a field selected from the JSON returned by a
+// remote resolver along with its nested selections
+type RemoteField struct {
+	Name     string
+	Children []RemoteField
+}
+
+// ArgVar is a variable used as the value of a remote field argument,
+// it's replaced with the value of the variable when the query is run
+type ArgVar string
+
+// compileRemoteArgs sets the arguments of the remote field as typed values
+// (string, int64, float64, bool, list, object or ArgVar) to be passed
+// to the resolver
+func (co *Compiler) compileRemoteArgs(sel *Select, args []graph.Arg) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	sel.RemoteArgs = make(map[string]interface{}, len(args))
+
+	for _, arg := range args {
+		v, err := remoteArgVal(arg.Val)
+		if err != nil {
+			return fmt.Errorf("argument '%s': %w", arg.Name, err)
+		}
+		sel.RemoteArgs[arg.Name] = v
+	}
+	return nil
+}
+
+func remoteArgVal(node *graph.Node) (interface{}, error) {
+	switch node.Type {
+	case graph.NodeStr:
+		return node.Val, nil
+
+	case graph.NodeNum:
+		if n, err := strconv.ParseInt(node.Val, 10, 64); err == nil {
+			return n, nil
+		}
+		return strconv.ParseFloat(node.Val, 64)
+
+	case graph.NodeBool:
+		return strconv.ParseBool(node.Val)
+
+	case graph.NodeVar:
+		return ArgVar(node.Val), nil
+
+	case graph.NodeList:
+		list := make([]interface{}, 0, len(node.Children))
+		for _, cn := range node.Children {
+			v, err := remoteArgVal(cn)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+
+	case graph.NodeObj:
+		obj := make(map[string]interface{}, len(node.Children))
+		for _, cn := range node.Children {
+			v, err := remoteArgVal(cn)
+			if err != nil {
+				return nil, err
+			}
+			obj[cn.Name] = v
+		}
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("unsupported value: %s", node.Val)
+}
+
+// remoteFields returns the fields selected from the remote JSON, nested
+// selections are included as children of the field
+func remoteFields(op *graph.Operation, ids []int32) []RemoteField {
+	fields := make([]RemoteField, 0, len(ids))
+
+	for _, id := range ids {
+		f := op.Fields[id]
+
+		rf := RemoteField{Name: f.Name}
+		if f.Alias != "" {
+			rf.Name = f.Alias
+		}
+
+		if len(f.Children) != 0 {
+			rf.Children = remoteFields(op, f.Children)
+		}
+		fields = append(fields, rf)
+	}
+	return fields
+}
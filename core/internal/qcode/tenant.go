@@ -0,0 +1,38 @@
+package qcode
+
+import (
+	"github.com/dosco/graphjin/core/internal/sdata"
+)
+
+// tenantVar is the variable the tenant column is matched against
+// and preset to
+const tenantVar = "__tenant_id"
+
+// tenantFilter returns a filter matching the tenant column of the table to
+// the tenant variable. Returns nil if a tenant column is not set or the
+// table does not have the column
+func (co *Compiler) tenantFilter(ti sdata.DBTable) *Exp {
+	col, ok := co.tenantColumn(ti)
+	if !ok {
+		return nil
+	}
+
+	ex := newExpOp(OpEquals)
+	ex.Left.Col = col
+	ex.Right.ValType = ValVar
+	ex.Right.Val = tenantVar
+	return ex
+}
+
+// tenantColumn returns the tenant column of the table if it has one
+func (co *Compiler) tenantColumn(ti sdata.DBTable) (sdata.DBColumn, bool) {
+	if co.c.TenantColumn == "" {
+		return sdata.DBColumn{}, false
+	}
+
+	col, err := ti.GetColumn(co.c.TenantColumn)
+	if err != nil {
+		return sdata.DBColumn{}, false
+	}
+	return col, true
+}
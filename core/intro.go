@@ -0,0 +1,1005 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dosco/graphjin/core/internal/graph"
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/dosco/graphjin/core/internal/sdata"
+	"github.com/dosco/graphjin/core/internal/util"
+	"github.com/goccy/go-json"
+)
+
+const (
+	kindScalar      = "SCALAR"
+	kindObject      = "OBJECT"
+	kindEnum        = "ENUM"
+	kindInputObject = "INPUT_OBJECT"
+	kindList        = "LIST"
+	kindNonNull     = "NON_NULL"
+)
+
+var introRe = regexp.MustCompile(`__schema|__type\s*\(`)
+
+type introSchema struct {
+	types        []*introType
+	tm           map[string]*introType
+	query        *introType
+	mutation     *introType
+	subscription *introType
+	directives   []introDirective
+}
+
+type introType struct {
+	kind        string
+	name        string
+	desc        string
+	fields      []introField
+	inputFields []introValue
+	enumValues  []introEnum
+	ofType      *introType
+}
+
+type introField struct {
+	name string
+	desc string
+	args []introValue
+	typ  *introType
+}
+
+type introValue struct {
+	name   string
+	desc   string
+	typ    *introType
+	defVal string
+}
+
+type introEnum struct {
+	name string
+	desc string
+}
+
+type introDirective struct {
+	name      string
+	desc      string
+	locations []string
+	args      []introValue
+}
+
+// introTable holds the details of a database table needed
+// to build its object and input types
+type introTable struct {
+	ti   sdata.DBTable
+	rels []introRel
+}
+
+type introRel struct {
+	name     string
+	ti       sdata.DBTable
+	singular bool
+	remote   bool
+	rtype    sdata.RelType
+}
+
+// introspection returns true if introspection queries are answered, they
+// are disabled when the allow list is enforced since only the queries in
+// the allow list can be run
+func (gj *graphjin) introspection() bool {
+	return !gj.conf.DisableIntrospection &&
+		(gj.conf.DisableAllowList || gj.conf.Debug)
+}
+
+// isIntroQuery does a quick check to see if the query could be an
+// introspection query
+func isIntroQuery(query string) bool {
+	return strings.Contains(query, "__") && introRe.MatchString(query)
+}
+
+// introQuery answers introspection queries, ok is false if the query
+// does not contain any introspection fields
+func (gj *graphjin) introQuery(query string, vars json.RawMessage, role string) (
+	data []byte, ok bool, err error) {
+
+	op, err := graph.Parse([]byte(query), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var introF, otherF int
+	for _, f := range op.Fields {
+		if f.ParentID != -1 {
+			continue
+		}
+		switch f.Name {
+		case "__schema", "__type":
+			introF++
+		case "__typename":
+		default:
+			otherF++
+		}
+	}
+
+	if introF == 0 {
+		return nil, false, nil
+	}
+
+	if otherF != 0 {
+		return nil, true, fmt.Errorf("introspection: cannot be mixed with other fields")
+	}
+
+	s, err := gj.getIntroSchema(role)
+	if err != nil {
+		return nil, true, err
+	}
+
+	ie := introExec{s: s, op: &op}
+
+	if len(vars) != 0 {
+		if err := json.Unmarshal(vars, &ie.vars); err != nil {
+			return nil, true, fmt.Errorf("variables: %w", err)
+		}
+	}
+
+	if err := ie.execute(); err != nil {
+		return nil, true, err
+	}
+	return ie.w.Bytes(), true, nil
+}
+
+func (gj *graphjin) getIntroSchema(role string) (*introSchema, error) {
+	if v, ok := gj.intro.Load(role); ok {
+		return v.(*introSchema), nil
+	}
+
+	s, err := gj.newIntroSchema(role)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := gj.intro.LoadOrStore(role, s)
+	return v.(*introSchema), nil
+}
+
+func (gj *graphjin) newIntroSchema(role string) (*introSchema, error) {
+	s := &introSchema{
+		tm: make(map[string]*introType),
+	}
+
+	for _, name := range []string{"Int", "Float", "String", "Boolean", "ID", "JSON", "Time"} {
+		s.addType(&introType{kind: kindScalar, name: name})
+	}
+
+	s.addType(&introType{
+		kind: kindEnum,
+		name: "OrderDirection",
+		desc: "Sort order of a column",
+		enumValues: []introEnum{
+			{name: "asc"},
+			{name: "desc"},
+			{name: "asc_nulls_first"},
+			{name: "desc_nulls_first"},
+			{name: "asc_nulls_last"},
+			{name: "desc_nulls_last"},
+		},
+	})
+
+	for _, name := range []string{"Int", "Float", "String", "Boolean", "ID", "JSON", "Time"} {
+		s.addExpressionType(name)
+	}
+
+	tables, err := gj.introTables(role)
+	if err != nil {
+		return nil, err
+	}
+
+	// all table types are created upfront since they reference each other
+	for _, t := range tables {
+		s.addType(&introType{kind: kindObject, name: t.ti.Name})
+		s.addType(&introType{kind: kindInputObject, name: t.ti.Name + "Where"})
+		s.addType(&introType{kind: kindInputObject, name: t.ti.Name + "OrderBy"})
+		s.addType(&introType{kind: kindInputObject, name: t.ti.Name + "Insert"})
+		s.addType(&introType{kind: kindInputObject, name: t.ti.Name + "Update"})
+	}
+
+	for _, t := range tables {
+		gj.addTableTypes(s, role, t)
+	}
+
+	s.query = &introType{kind: kindObject, name: "Query"}
+	s.subscription = &introType{kind: kindObject, name: "Subscription"}
+	mutation := &introType{kind: kindObject, name: "Mutation"}
+
+	aliases := make(map[string][]string)
+	for name, t := range gj.schema.GetAliases() {
+		aliases[t.Name] = append(aliases[t.Name], name)
+	}
+
+	for _, t := range tables {
+		name := t.ti.Name
+
+		if !gj.qc.IsBlocked(role, t.ti.Schema, name, qcode.QTQuery) {
+			names := append([]string{name}, aliases[name]...)
+			sort.Strings(names[1:])
+
+			for _, n := range names {
+				f := s.rootQueryFields(gj.fieldName(n), name, gj.schema.SingularSuffix)
+				s.query.fields = append(s.query.fields, f...)
+				s.subscription.fields = append(s.subscription.fields, f...)
+			}
+		}
+
+		if f, ok := gj.rootMutationField(s, role, t); ok {
+			mutation.fields = append(mutation.fields, f)
+		}
+	}
+
+	s.addType(s.query)
+	s.addType(s.subscription)
+
+	if len(mutation.fields) != 0 {
+		s.mutation = mutation
+		s.addType(mutation)
+	}
+
+	s.directives = introDirectives(s)
+
+	return s, nil
+}
+
+// introTables returns the tables (and their relationships) visible to the role
+func (gj *graphjin) introTables(role string) ([]introTable, error) {
+	var tables []introTable
+	ts := make(map[string]struct{})
+
+	for _, t := range gj.schema.GetTables() {
+		if !gj.introTableVisible(role, t) {
+			continue
+		}
+		tables = append(tables, introTable{ti: t})
+		ts[t.Name] = struct{}{}
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].ti.Name < tables[j].ti.Name
+	})
+
+	ssufx := gj.schema.SingularSuffix
+
+	for i := range tables {
+		t := &tables[i]
+
+		edges, err := gj.schema.GetFirstDegree(t.ti.Schema, t.ti.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, 0, len(edges))
+		for name := range edges {
+			if ssufx != "" && strings.HasSuffix(name, ssufx) {
+				if _, ok := edges[strings.TrimSuffix(name, ssufx)]; ok {
+					continue
+				}
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			paths, err := gj.schema.FindPath(name, t.ti.Name, "")
+			if err != nil {
+				continue
+			}
+			rel := sdata.PathToRel(paths[0])
+			r := introRel{name: name, rtype: rel.Type}
+
+			switch rel.Type {
+			case sdata.RelEmbedded:
+				continue
+			case sdata.RelRemote:
+				r.remote = true
+			case sdata.RelPolymorphic, sdata.RelNone:
+				if r.ti, err = gj.schema.Find(t.ti.Schema, name); err != nil {
+					continue
+				}
+			default:
+				r.ti = rel.Left.Ti
+			}
+
+			if !r.remote {
+				if _, ok := ts[r.ti.Name]; !ok {
+					continue
+				}
+			}
+
+			if len(paths) == 1 &&
+				((rel.Type == sdata.RelOneToMany && !rel.Right.Col.Array) ||
+					rel.Type == sdata.RelPolymorphic) {
+				r.singular = true
+			}
+			t.rels = append(t.rels, r)
+		}
+	}
+
+	return tables, nil
+}
+
+func (gj *graphjin) introTableVisible(role string, t sdata.DBTable) bool {
+	if t.Blocked || t.Schema != gj.schema.DBSchema() {
+		return false
+	}
+
+	switch t.Type {
+	case "virtual", "remote", "json", "jsonb":
+		return false
+	}
+
+	for _, qt := range []qcode.QType{
+		qcode.QTQuery, qcode.QTInsert, qcode.QTUpdate, qcode.QTUpsert, qcode.QTDelete} {
+		if !gj.qc.IsBlocked(role, t.Schema, t.Name, qt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (gj *graphjin) addTableTypes(s *introSchema, role string, t introTable) {
+	ti := t.ti
+
+	ot := s.tm[ti.Name]
+	wt := s.tm[ti.Name+"Where"]
+	obt := s.tm[ti.Name+"OrderBy"]
+	it := s.tm[ti.Name+"Insert"]
+	ut := s.tm[ti.Name+"Update"]
+
+	ot.desc = fmt.Sprintf("Table: %s.%s", ti.Schema, ti.Name)
+	fields := make(map[string]struct{})
+
+	for _, c := range ti.Columns {
+		if c.Blocked {
+			continue
+		}
+		name := gj.fieldName(c.Name)
+		typ := s.tm[introScalar(c.Type)]
+
+		if gj.qc.IsColumnAllowed(role, ti.Schema, ti.Name, qcode.QTQuery, c.Name) {
+			ft := typ
+			if c.Array {
+				ft = listOf(nonNull(ft))
+			}
+			if c.NotNull {
+				ft = nonNull(ft)
+			}
+			ot.fields = append(ot.fields, introField{name: name, typ: ft})
+			fields[name] = struct{}{}
+
+			wt.inputFields = append(wt.inputFields,
+				introValue{name: name, typ: s.tm[typ.name+"Expression"]})
+
+			obt.inputFields = append(obt.inputFields,
+				introValue{name: name, typ: s.tm["OrderDirection"]})
+		}
+
+		if c.Array {
+			typ = listOf(typ)
+		}
+
+		if gj.qc.IsColumnAllowed(role, ti.Schema, ti.Name, qcode.QTInsert, c.Name) {
+			it.inputFields = append(it.inputFields, introValue{name: name, typ: typ})
+		}
+
+		if gj.qc.IsColumnAllowed(role, ti.Schema, ti.Name, qcode.QTUpdate, c.Name) {
+			ut.inputFields = append(ut.inputFields, introValue{name: name, typ: typ})
+		}
+	}
+
+	for _, r := range t.rels {
+		name := gj.fieldName(r.name)
+		if _, ok := fields[name]; ok {
+			continue
+		}
+		fields[name] = struct{}{}
+
+		if r.remote {
+			ot.fields = append(ot.fields, introField{name: name, typ: s.tm["JSON"]})
+			continue
+		}
+
+		rn := r.ti.Name
+		f := introField{name: name}
+
+		if r.singular {
+			f.typ = s.tm[rn]
+			f.args = []introValue{{name: "where", typ: s.tm[rn+"Where"]}}
+		} else {
+			f.typ = listOf(nonNull(s.tm[rn]))
+			f.args = s.listArgs(rn)
+		}
+
+		if r.rtype == sdata.RelRecursive {
+			f.args = append(f.args, introValue{
+				name: "find",
+				desc: "Find 'parents' or 'children' in a recursive relationship",
+				typ:  s.tm["String"]})
+		}
+		ot.fields = append(ot.fields, f)
+
+		wt.inputFields = append(wt.inputFields, introValue{name: name, typ: s.tm[rn+"Where"]})
+		it.inputFields = append(it.inputFields, introValue{name: name, typ: s.tm[rn+"Insert"]})
+		ut.inputFields = append(ut.inputFields, introValue{name: name, typ: s.tm[rn+"Update"]})
+	}
+
+	wl := listOf(nonNull(wt))
+	wt.inputFields = append(wt.inputFields,
+		introValue{name: "and", typ: wl},
+		introValue{name: "or", typ: wl},
+		introValue{name: "not", typ: wt})
+
+	it.inputFields = append(it.inputFields,
+		introValue{name: "connect", desc: "Connect to existing rows", typ: s.tm["JSON"]})
+
+	ut.inputFields = append(ut.inputFields,
+		introValue{name: "connect", desc: "Connect to existing rows", typ: s.tm["JSON"]},
+		introValue{name: "disconnect", desc: "Disconnect from related rows", typ: s.tm["JSON"]},
+		introValue{name: "where", typ: wt})
+}
+
+func (s *introSchema) rootQueryFields(name, table, ssufx string) []introField {
+	ot := s.tm[table]
+
+	return []introField{{
+		name: name,
+		desc: ot.desc,
+		args: s.listArgs(table),
+		typ:  listOf(nonNull(ot)),
+	}, {
+		name: name + ssufx,
+		desc: ot.desc,
+		args: []introValue{
+			{name: "id", typ: nonNull(s.tm["ID"])},
+			{name: "where", typ: s.tm[table+"Where"]},
+		},
+		typ: ot,
+	}}
+}
+
+func (gj *graphjin) rootMutationField(s *introSchema, role string, t introTable) (introField, bool) {
+	ti := t.ti
+	f := introField{
+		name: gj.fieldName(ti.Name),
+		desc: s.tm[ti.Name].desc,
+		typ:  listOf(nonNull(s.tm[ti.Name])),
+	}
+
+	blocked := func(qt qcode.QType) bool {
+		return gj.qc.IsBlocked(role, ti.Schema, ti.Name, qt)
+	}
+
+	if !blocked(qcode.QTInsert) {
+		f.args = append(f.args, introValue{name: "insert", typ: s.tm[ti.Name+"Insert"]})
+	}
+	if !blocked(qcode.QTUpdate) {
+		f.args = append(f.args, introValue{name: "update", typ: s.tm[ti.Name+"Update"]})
+	}
+	if !blocked(qcode.QTUpsert) {
+		f.args = append(f.args, introValue{name: "upsert", typ: s.tm[ti.Name+"Insert"]})
+	}
+	if !blocked(qcode.QTDelete) {
+		f.args = append(f.args, introValue{name: "delete", typ: s.tm["Boolean"]})
+	}
+
+	if len(f.args) == 0 {
+		return f, false
+	}
+
+	f.args = append(f.args,
+		introValue{name: "id", typ: s.tm["ID"]},
+		introValue{name: "where", typ: s.tm[ti.Name+"Where"]})
+
+	return f, true
+}
+
+func (s *introSchema) listArgs(table string) []introValue {
+	return []introValue{
+		{name: "where", typ: s.tm[table+"Where"]},
+		{name: "order_by", typ: s.tm[table+"OrderBy"]},
+		{name: "limit", typ: s.tm["Int"]},
+		{name: "offset", typ: s.tm["Int"]},
+		{name: "distinct", typ: listOf(nonNull(s.tm["String"]))},
+		{name: "search", desc: "Full text search", typ: s.tm["String"]},
+		{name: "first", typ: s.tm["Int"]},
+		{name: "last", typ: s.tm["Int"]},
+		{name: "after", desc: "Cursor to fetch rows after", typ: s.tm["String"]},
+		{name: "before", desc: "Cursor to fetch rows before", typ: s.tm["String"]},
+	}
+}
+
+func (s *introSchema) addType(t *introType) {
+	s.types = append(s.types, t)
+	s.tm[t.name] = t
+}
+
+func (s *introSchema) addExpressionType(name string) {
+	typ := s.tm[name]
+	list := listOf(nonNull(typ))
+
+	t := &introType{
+		kind: kindInputObject,
+		name: name + "Expression",
+		inputFields: []introValue{
+			{name: "eq", typ: typ},
+			{name: "neq", typ: typ},
+			{name: "gt", typ: typ},
+			{name: "lt", typ: typ},
+			{name: "gte", typ: typ},
+			{name: "lte", typ: typ},
+			{name: "in", typ: list},
+			{name: "nin", typ: list},
+			{name: "is_null", typ: s.tm["Boolean"]},
+			{name: "ndis", desc: "Not distinct from", typ: typ},
+			{name: "dis", desc: "Distinct from", typ: typ},
+		},
+	}
+
+	switch name {
+	case "String":
+		for _, op := range []string{"like", "nlike", "ilike", "nilike",
+			"similar", "nsimilar", "regex", "nregex", "iregex", "niregex"} {
+			t.inputFields = append(t.inputFields, introValue{name: op, typ: typ})
+		}
+
+	case "JSON":
+		sl := listOf(nonNull(s.tm["String"]))
+		t.inputFields = append(t.inputFields,
+			introValue{name: "contains", typ: typ},
+			introValue{name: "contained_in", typ: typ},
+			introValue{name: "has_key", typ: s.tm["String"]},
+			introValue{name: "has_key_any", typ: sl},
+			introValue{name: "has_key_all", typ: sl})
+	}
+
+	s.addType(t)
+}
+
+func introDirectives(s *introSchema) []introDirective {
+	cond := []introValue{{name: "if", typ: nonNull(s.tm["Boolean"])}}
+	ops := []string{"QUERY", "MUTATION", "SUBSCRIPTION"}
+
+	return []introDirective{{
+		name:      "skip",
+		desc:      "Skip this field if the argument is true",
+		locations: []string{"FIELD"},
+		args:      cond,
+	}, {
+		name:      "include",
+		desc:      "Include this field only if the argument is true",
+		locations: []string{"FIELD"},
+		args:      cond,
+	}, {
+		name:      "cacheControl",
+		desc:      "Set the HTTP cache-control header",
+		locations: ops,
+		args: []introValue{
+			{name: "maxAge", typ: nonNull(s.tm["Int"])},
+			{name: "scope", typ: s.tm["String"]},
+		},
+	}, {
+		name:      "script",
+		desc:      "Run the query through a script",
+		locations: ops,
+		args:      []introValue{{name: "name", typ: s.tm["String"]}},
+	}, {
+		name:      "object",
+		desc:      "Return a single object instead of a list",
+		locations: []string{"FIELD"},
+	}, {
+		name:      "through",
+		desc:      "Join through the specified table or column",
+		locations: []string{"FIELD"},
+		args: []introValue{
+			{name: "table", typ: s.tm["String"]},
+			{name: "column", typ: s.tm["String"]},
+		},
+	}, {
+		name:      "notRelated",
+		desc:      "Do not relate this field to its parent",
+		locations: []string{"FIELD"},
+	}}
+}
+
+func (gj *graphjin) fieldName(name string) string {
+	if gj.conf.EnableCamelcase {
+		return util.ToCamel(name)
+	}
+	return name
+}
+
+// introScalar maps a database column type to a GraphQL scalar
+func introScalar(typ string) string {
+	t := strings.ToLower(typ)
+
+	if i := strings.IndexByte(t, '('); i != -1 {
+		t = t[:i]
+	}
+	t = strings.TrimSpace(strings.TrimSuffix(t, "[]"))
+
+	switch {
+	case strings.Contains(t, "int"), strings.Contains(t, "serial"):
+		return "Int"
+	case strings.HasPrefix(t, "numeric"), strings.HasPrefix(t, "decimal"),
+		strings.HasPrefix(t, "real"), strings.HasPrefix(t, "double"),
+		strings.HasPrefix(t, "float"), t == "money":
+		return "Float"
+	case strings.HasPrefix(t, "bool"):
+		return "Boolean"
+	case strings.HasPrefix(t, "json"):
+		return "JSON"
+	case strings.HasPrefix(t, "timestamp"), strings.HasPrefix(t, "date"),
+		strings.HasPrefix(t, "time"):
+		return "Time"
+	}
+	return "String"
+}
+
+func listOf(t *introType) *introType {
+	return &introType{kind: kindList, ofType: t}
+}
+
+func nonNull(t *introType) *introType {
+	return &introType{kind: kindNonNull, ofType: t}
+}
+
+// introExec executes an introspection query against an introSchema
+type introExec struct {
+	s    *introSchema
+	op   *graph.Operation
+	vars map[string]json.RawMessage
+	w    bytes.Buffer
+}
+
+func (ie *introExec) execute() error {
+	return ie.writeObj(-1, "Query", func(f graph.Field) error {
+		switch f.Name {
+		case "__schema":
+			return ie.writeSchema(f)
+
+		case "__type":
+			name, err := ie.argString(f, "name")
+			if err != nil {
+				return err
+			}
+			return ie.writeType(f, ie.s.tm[name])
+		}
+		return fmt.Errorf("introspection: unknown field: %s", f.Name)
+	})
+}
+
+func (ie *introExec) writeSchema(f graph.Field) error {
+	return ie.writeObj(f.ID, "__Schema", func(f graph.Field) error {
+		switch f.Name {
+		case "description":
+			ie.w.WriteString(`null`)
+
+		case "types":
+			return ie.writeList(len(ie.s.types), func(i int) error {
+				return ie.writeType(f, ie.s.types[i])
+			})
+
+		case "queryType":
+			return ie.writeType(f, ie.s.query)
+
+		case "mutationType":
+			return ie.writeType(f, ie.s.mutation)
+
+		case "subscriptionType":
+			return ie.writeType(f, ie.s.subscription)
+
+		case "directives":
+			return ie.writeList(len(ie.s.directives), func(i int) error {
+				return ie.writeDirective(f, ie.s.directives[i])
+			})
+
+		default:
+			return fmt.Errorf("introspection: unknown field on __Schema: %s", f.Name)
+		}
+		return nil
+	})
+}
+
+func (ie *introExec) writeType(f graph.Field, t *introType) error {
+	if t == nil {
+		ie.w.WriteString(`null`)
+		return nil
+	}
+
+	return ie.writeObj(f.ID, "__Type", func(f graph.Field) error {
+		switch f.Name {
+		case "kind":
+			ie.writeString(t.kind)
+
+		case "name":
+			ie.writeNullString(t.name)
+
+		case "description":
+			ie.writeNullString(t.desc)
+
+		case "specifiedByURL", "specifiedByUrl", "possibleTypes":
+			ie.w.WriteString(`null`)
+
+		case "fields":
+			if t.kind != kindObject {
+				ie.w.WriteString(`null`)
+				break
+			}
+			return ie.writeList(len(t.fields), func(i int) error {
+				return ie.writeField(f, t.fields[i])
+			})
+
+		case "interfaces":
+			if t.kind != kindObject {
+				ie.w.WriteString(`null`)
+				break
+			}
+			ie.w.WriteString(`[]`)
+
+		case "enumValues":
+			if t.kind != kindEnum {
+				ie.w.WriteString(`null`)
+				break
+			}
+			return ie.writeList(len(t.enumValues), func(i int) error {
+				return ie.writeEnum(f, t.enumValues[i])
+			})
+
+		case "inputFields":
+			if t.kind != kindInputObject {
+				ie.w.WriteString(`null`)
+				break
+			}
+			return ie.writeList(len(t.inputFields), func(i int) error {
+				return ie.writeValue(f, t.inputFields[i])
+			})
+
+		case "ofType":
+			return ie.writeType(f, t.ofType)
+
+		default:
+			return fmt.Errorf("introspection: unknown field on __Type: %s", f.Name)
+		}
+		return nil
+	})
+}
+
+func (ie *introExec) writeField(f graph.Field, fi introField) error {
+	return ie.writeObj(f.ID, "__Field", func(f graph.Field) error {
+		switch f.Name {
+		case "name":
+			ie.writeString(fi.name)
+
+		case "description":
+			ie.writeNullString(fi.desc)
+
+		case "args":
+			return ie.writeList(len(fi.args), func(i int) error {
+				return ie.writeValue(f, fi.args[i])
+			})
+
+		case "type":
+			return ie.writeType(f, fi.typ)
+
+		case "isDeprecated":
+			ie.w.WriteString(`false`)
+
+		case "deprecationReason":
+			ie.w.WriteString(`null`)
+
+		default:
+			return fmt.Errorf("introspection: unknown field on __Field: %s", f.Name)
+		}
+		return nil
+	})
+}
+
+func (ie *introExec) writeValue(f graph.Field, v introValue) error {
+	return ie.writeObj(f.ID, "__InputValue", func(f graph.Field) error {
+		switch f.Name {
+		case "name":
+			ie.writeString(v.name)
+
+		case "description":
+			ie.writeNullString(v.desc)
+
+		case "type":
+			return ie.writeType(f, v.typ)
+
+		case "defaultValue":
+			ie.writeNullString(v.defVal)
+
+		case "isDeprecated":
+			ie.w.WriteString(`false`)
+
+		case "deprecationReason":
+			ie.w.WriteString(`null`)
+
+		default:
+			return fmt.Errorf("introspection: unknown field on __InputValue: %s", f.Name)
+		}
+		return nil
+	})
+}
+
+func (ie *introExec) writeEnum(f graph.Field, v introEnum) error {
+	return ie.writeObj(f.ID, "__EnumValue", func(f graph.Field) error {
+		switch f.Name {
+		case "name":
+			ie.writeString(v.name)
+
+		case "description":
+			ie.writeNullString(v.desc)
+
+		case "isDeprecated":
+			ie.w.WriteString(`false`)
+
+		case "deprecationReason":
+			ie.w.WriteString(`null`)
+
+		default:
+			return fmt.Errorf("introspection: unknown field on __EnumValue: %s", f.Name)
+		}
+		return nil
+	})
+}
+
+func (ie *introExec) writeDirective(f graph.Field, d introDirective) error {
+	return ie.writeObj(f.ID, "__Directive", func(f graph.Field) error {
+		switch f.Name {
+		case "name":
+			ie.writeString(d.name)
+
+		case "description":
+			ie.writeNullString(d.desc)
+
+		case "locations":
+			return ie.writeList(len(d.locations), func(i int) error {
+				ie.writeString(d.locations[i])
+				return nil
+			})
+
+		case "args":
+			return ie.writeList(len(d.args), func(i int) error {
+				return ie.writeValue(f, d.args[i])
+			})
+
+		case "isRepeatable":
+			ie.w.WriteString(`false`)
+
+		default:
+			return fmt.Errorf("introspection: unknown field on __Directive: %s", f.Name)
+		}
+		return nil
+	})
+}
+
+// writeObj writes out a json object with a key for each selected child field
+// of the field with id, the '__typename' field is handled here
+func (ie *introExec) writeObj(id int32, typename string, fn func(f graph.Field) error) error {
+	ie.w.WriteByte('{')
+
+	for i, f := range ie.selection(id) {
+		if i != 0 {
+			ie.w.WriteByte(',')
+		}
+
+		if f.Alias != "" {
+			ie.writeString(f.Alias)
+		} else {
+			ie.writeString(f.Name)
+		}
+		ie.w.WriteByte(':')
+
+		if f.Name == "__typename" {
+			ie.writeString(typename)
+			continue
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	ie.w.WriteByte('}')
+	return nil
+}
+
+func (ie *introExec) writeList(n int, fn func(i int) error) error {
+	ie.w.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i != 0 {
+			ie.w.WriteByte(',')
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	ie.w.WriteByte(']')
+	return nil
+}
+
+func (ie *introExec) writeString(v string) {
+	b, _ := json.Marshal(v)
+	ie.w.Write(b)
+}
+
+func (ie *introExec) writeNullString(v string) {
+	if v == "" {
+		ie.w.WriteString(`null`)
+	} else {
+		ie.writeString(v)
+	}
+}
+
+// selection returns the child fields of the field with id (root fields
+// for -1), inline fragments are flattened and duplicate keys are removed
+func (ie *introExec) selection(id int32) []graph.Field {
+	var fields []graph.Field
+	seen := make(map[string]struct{})
+
+	var children []int32
+	if id == -1 {
+		for _, f := range ie.op.Fields {
+			if f.ParentID == -1 {
+				children = append(children, f.ID)
+			}
+		}
+	} else {
+		children = ie.op.Fields[id].Children
+	}
+
+	for _, cid := range children {
+		f := ie.op.Fields[cid]
+
+		if f.Type == graph.FieldMember && len(f.Children) != 0 &&
+			strings.HasPrefix(f.Name, "__") && f.Name != "__typename" {
+			for _, f1 := range ie.selection(f.ID) {
+				k := f1.Alias + ":" + f1.Name
+				if _, ok := seen[k]; !ok {
+					fields = append(fields, f1)
+					seen[k] = struct{}{}
+				}
+			}
+			continue
+		}
+
+		k := f.Alias + ":" + f.Name
+		if _, ok := seen[k]; !ok {
+			fields = append(fields, f)
+			seen[k] = struct{}{}
+		}
+	}
+	return fields
+}
+
+func (ie *introExec) argString(f graph.Field, name string) (string, error) {
+	for _, a := range f.Args {
+		if a.Name != name {
+			continue
+		}
+
+		switch a.Val.Type {
+		case graph.NodeStr:
+			return a.Val.Val, nil
+
+		case graph.NodeVar:
+			var v string
+			if err := json.Unmarshal(ie.vars[a.Val.Val], &v); err != nil {
+				return "", fmt.Errorf("introspection: variable '%s' must be a string", a.Val.Val)
+			}
+			return v, nil
+		}
+		return "", fmt.Errorf("introspection: argument '%s' must be a string", name)
+	}
+	return "", fmt.Errorf("introspection: argument '%s' required on field: %s", name, f.Name)
+}
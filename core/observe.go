@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+)
+
+// Event is a step in the request pipeline
+type Event string
+
+const (
+	EventRoleQuery    Event = "graphjin.role_query"
+	EventQCodeCompile Event = "graphjin.qcode_compile"
+	EventPSQLCompile  Event = "graphjin.psql_compile"
+	EventDBQuery      Event = "graphjin.db_query"
+	EventRemoteJoin   Event = "graphjin.remote_join"
+	EventSubPoll      Event = "graphjin.subscription_poll"
+)
+
+// Observer is used to add tracing spans or metrics (eg. OpenTelemetry)
+// around the steps of the request pipeline. Start is called at the start of
+// each step and End is called on the returned span once the step is done.
+//
+// Example usage:
+/*
+	type otelObserver struct {
+		tracer trace.Tracer
+	}
+
+	func (o *otelObserver) Start(c context.Context, ev core.Event, a core.Attrs) (
+		context.Context, core.Span) {
+		c, span := o.tracer.Start(c, string(ev))
+		return c, &otelSpan{span}
+	}
+
+	gj, err := core.NewGraphJin(conf, db, core.WithObserver(&otelObserver{tracer}))
+*/
+type Observer interface {
+	Start(c context.Context, ev Event, attrs Attrs) (context.Context, Span)
+}
+
+// Span is returned by the Observer at the start of a step. The attributes
+// passed to End are the ones only known once the step is done (eg. role, SQL)
+type Span interface {
+	End(attrs Attrs, err error)
+}
+
+// Attrs are the attributes of an event
+type Attrs struct {
+	OpName string
+	Role   string
+	SQL    string
+	qc     *qcode.QCode
+}
+
+// Tables returns the list of tables used in the query
+func (a Attrs) Tables() []string {
+	if a.qc == nil {
+		return nil
+	}
+	return queryTables(a.qc)
+}
+
+// WithObserver sets the observer to be called around each step
+// of the request pipeline
+func WithObserver(obs Observer) Option {
+	return func(gj *graphjin) error {
+		gj.obs = obs
+		return nil
+	}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) End(Attrs, error) {}
+
+// start starts a span for the event, when no observer is
+// set it returns a no-op span
+func (gj *graphjin) start(c context.Context, ev Event, attrs Attrs) (context.Context, Span) {
+	if gj.obs == nil {
+		return c, nopSpan{}
+	}
+	return gj.obs.Start(c, ev, attrs)
+}
@@ -81,11 +81,18 @@ func (gj *graphjin) initAllowList() error {
 		return nil
 	}
 
-	gj.queries = make(map[string]*queryComp)
+	gj.queries, err = gj.loadAllowList()
+	return err
+}
+
+// loadAllowList loads the queries from the allow list and adds
+// them to the APQ cache
+func (gj *graphjin) loadAllowList() (map[string]*queryComp, error) {
+	queries := make(map[string]*queryComp)
 
 	list, err := gj.allowList.Load()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for _, item := range list {
@@ -102,34 +109,35 @@ func (gj *graphjin) initAllowList() error {
 				name:  item.Name,
 				query: []byte(item.Query),
 				vars:  []byte(item.Vars),
-			}}
+			}, role: v.role}
 
 			if item.Metadata.Order.Var != "" {
 				qc.qr.order = [2]string{item.Metadata.Order.Var, strconv.Quote(v.val)}
 			}
-			gj.queries[v.key] = qc
+			queries[v.key] = qc
 		}
 
 		op, _ := qcode.GetQType(item.Query)
 		gj.apq.Set(item.Name, apqInfo{op: op, name: item.Name})
 	}
 
-	return nil
+	return queries, nil
 }
 
 type queryKey struct {
-	key string
-	val string
+	key  string
+	val  string
+	role string
 }
 
 func (gj *graphjin) getQueryKeys(item allow.Item) []queryKey {
 	var qk []queryKey
 
 	for roleName := range gj.roles {
-		qk = append(qk, queryKey{key: (item.Name + roleName)})
+		qk = append(qk, queryKey{key: (item.Name + roleName), role: roleName})
 
 		for _, v := range item.Metadata.Order.Values {
-			qk = append(qk, queryKey{key: (item.Name + roleName + v), val: v})
+			qk = append(qk, queryKey{key: (item.Name + roleName + v), val: v, role: roleName})
 		}
 	}
 	return qk
@@ -3,10 +3,20 @@ package core_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dosco/graphjin/core"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sync/errgroup"
 )
@@ -77,6 +87,14 @@ func TestAPQ(t *testing.T) {
 	exp := `{"products": {"id": 2}}`
 	got := string(res.Data)
 	assert.JSONEq(t, exp, got, "should equal")
+
+	op, name, ok := gj.PersistedOperation("getProducts")
+	assert.True(t, ok)
+	assert.Equal(t, core.OpQuery, op)
+	assert.Equal(t, "getProducts", name)
+
+	_, _, ok = gj.PersistedOperation("unknown")
+	assert.False(t, ok)
 }
 
 func TestAllowList(t *testing.T) {
@@ -314,3 +332,1188 @@ func BenchmarkCompile(b *testing.B) {
 		resultJSON = res.Data
 	}
 }
+
+func TestIntrospection(t *testing.T) {
+	gql := `query {
+		__type(name: "products") {
+			name
+			kind
+			fields {
+				name
+			}
+		}
+		__schema {
+			queryType {
+				name
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	err := conf.AddRoleTable("anon", "products", core.Query{
+		Columns: []string{"id", "name"},
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.NoError(t, err)
+
+	var v struct {
+		Type struct {
+			Name   string
+			Kind   string
+			Fields []struct{ Name string }
+		} `json:"__type"`
+		Schema struct {
+			QueryType struct{ Name string }
+		} `json:"__schema"`
+	}
+	err = json.Unmarshal(res.Data, &v)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "products", v.Type.Name)
+	assert.Equal(t, "OBJECT", v.Type.Kind)
+	assert.Equal(t, "Query", v.Schema.QueryType.Name)
+
+	var fields []string
+	for _, f := range v.Type.Fields {
+		fields = append(fields, f.Name)
+	}
+	assert.Contains(t, fields, "id")
+	assert.Contains(t, fields, "name")
+	assert.NotContains(t, fields, "price")
+}
+
+func TestDisableIntrospection(t *testing.T) {
+	gql := `query {
+		__schema {
+			queryType {
+				name
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true, DisableIntrospection: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	_, err = gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestSchemaSDL(t *testing.T) {
+	conf := newConfig(&core.Config{
+		DBType:           dbType,
+		DisableAllowList: true,
+		Tables: []core.Table{
+			{Name: "me", Table: "users"},
+		},
+	})
+	err := conf.AddRoleTable("anon", "products", core.Query{
+		Columns: []string{"id", "name"},
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	sdl, err := gj.Schema("anon")
+	assert.NoError(t, err)
+
+	assert.Contains(t, sdl, "type products {")
+	assert.Contains(t, sdl, "productsByID(id: ID!")
+	assert.Contains(t, sdl, "me(where: usersWhere")
+	assert.NotContains(t, sdl, "  price: ")
+	assert.NotContains(t, sdl, "directive @skip")
+	assert.NotContains(t, sdl, "directive @include")
+
+	sdl, err = gj.Schema("user")
+	assert.NoError(t, err)
+	assert.Contains(t, sdl, "  price: ")
+}
+
+func TestGraphQLTx(t *testing.T) {
+	gql := `mutation {
+		users(insert: $data) {
+			id
+			email
+		}
+	}`
+
+	vars := json.RawMessage(`{
+		"data": {
+			"id": 90001,
+			"email": "user90001@test.com",
+			"full_name": "User 90001",
+			"stripe_id": "payment_id_90001",
+			"category_counts": [{"category_id": 1, "count": 10}]
+		}
+	}`)
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	c := context.Background()
+	ctx := context.WithValue(c, core.UserIDKey, 3)
+
+	tx, err := pool.Begin(c)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQLTx(ctx, tx, gql, vars, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"users": [{"id": 90001, "email": "user90001@test.com"}]}`, string(res.Data))
+
+	var count int
+	err = tx.QueryRow(c, `SELECT count(*) FROM users WHERE id = 90001`).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = tx.Rollback(c)
+	assert.NoError(t, err)
+
+	err = pool.QueryRow(c, `SELECT count(*) FROM users WHERE id = 90001`).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestGraphQLBatch(t *testing.T) {
+	ops := []core.BatchOp{
+		{Query: `query { products(id: 2) { id } }`},
+		{Query: `query { not_a_table { id } }`},
+		{Query: `query { products(id: $id) { id } }`, Vars: json.RawMessage(`{"id": 3}`)},
+	}
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQLBatch(context.Background(), ops, false)
+	assert.NoError(t, err)
+	assert.Len(t, res, 3)
+
+	assert.JSONEq(t, `{"products": {"id": 2}}`, string(res[0].Data))
+	assert.NotEmpty(t, res[1].Errors)
+	assert.JSONEq(t, `{"products": {"id": 3}}`, string(res[2].Data))
+}
+
+func TestGraphQLBatchTx(t *testing.T) {
+	ops := []core.BatchOp{
+		{Query: `mutation {
+			users(insert: $data) {
+				id
+			}
+		}`, Vars: json.RawMessage(`{
+			"data": {
+				"id": 90002,
+				"email": "user90002@test.com",
+				"full_name": "User 90002",
+				"stripe_id": "payment_id_90002",
+				"category_counts": [{"category_id": 1, "count": 10}]
+			}
+		}`)},
+		{Query: `query { not_a_table { id } }`},
+	}
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), core.UserIDKey, 3)
+	res, err := gj.GraphQLBatch(ctx, ops, true)
+	assert.Error(t, err)
+	assert.Len(t, res, 2)
+	assert.Empty(t, res[0].Data)
+	if assert.NotEmpty(t, res[0].Errors) {
+		assert.ErrorIs(t, &res[0].Errors[0], core.ErrBatchRollback)
+		assert.Equal(t, core.CodeBatchRollback, res[0].Errors[0].Extensions.Code)
+	}
+	assert.NotEmpty(t, res[1].Errors)
+
+	var count int
+	err = pool.QueryRow(context.Background(), `SELECT count(*) FROM users WHERE id = 90002`).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestStructuredErrors(t *testing.T) {
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	err := conf.AddRoleTable("anon", "products", core.Query{
+		Columns: []string{"id", "name"},
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	c := context.Background()
+
+	res, err := gj.GraphQL(c, `query {
+		products {
+			id
+			price
+		}
+	}`, nil, nil)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+	assert.Equal(t, core.CodeForbidden, res.Errors[0].Extensions.Code)
+	assert.Equal(t, []string{"products"}, res.Errors[0].Path)
+	assert.Equal(t, []core.Location{{Line: 2, Column: 3}}, res.Errors[0].Locations)
+
+	res, err = gj.GraphQL(c, `query { products { id unknown_column } }`, nil, nil)
+	assert.ErrorIs(t, err, core.ErrValidation)
+	assert.Equal(t, core.CodeValidationFailed, res.Errors[0].Extensions.Code)
+	assert.Equal(t, []string{"products", "unknown_column"}, res.Errors[0].Path)
+	assert.Equal(t, []core.Location{{Line: 1, Column: 23}}, res.Errors[0].Locations)
+
+	// columns past 32767 on long (eg. minified) lines
+	res, err = gj.GraphQL(c, "query { products { id"+strings.Repeat(" ", 40000)+
+		" unknown_column } }", nil, nil)
+	assert.ErrorIs(t, err, core.ErrValidation)
+	assert.Equal(t, []core.Location{{Line: 1, Column: 40023}}, res.Errors[0].Locations)
+
+	res, err = gj.GraphQL(c, `query { products { id }`, nil, nil)
+	assert.ErrorIs(t, err, core.ErrValidation)
+	assert.Equal(t, core.CodeParseFailed, res.Errors[0].Extensions.Code)
+
+	ctx := context.WithValue(c, core.UserIDKey, 3)
+	res, err = gj.GraphQL(ctx, `mutation {
+		users(insert: $data) {
+			id
+		}
+	}`, json.RawMessage(`{"data": {"id": 1, "email": "user1@test.com"}}`), nil)
+	assert.ErrorIs(t, err, core.ErrConstraintViolation)
+	assert.Equal(t, core.CodeConstraintViolation, res.Errors[0].Extensions.Code)
+
+	res, err = gj.GraphQL(c, "", nil, &core.ReqConfig{APQKey: "unknown"})
+	assert.ErrorIs(t, err, core.ErrPersistedQueryNotFound)
+	assert.Equal(t, core.CodePersistedQueryNotFound, res.Errors[0].Extensions.Code)
+}
+
+type testRemote struct{}
+
+func (r *testRemote) Resolve(req core.ResolverReq) ([]byte, error) {
+	return []byte(`{"payment_id": "` + req.ID + `", "amount": 100}`), nil
+}
+
+func TestTracing(t *testing.T) {
+	gql := `query {
+		users(where: { id: { lt: 4 } }) {
+			id
+			payments {
+				amount
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true, EnableTracing: true})
+	conf.Resolvers = []core.ResolverConfig{{
+		Name:   "payments",
+		Type:   "test_remote",
+		Table:  "users",
+		Column: "stripe_id",
+	}}
+
+	err := conf.SetResolver("test_remote", func(v core.ResolverProps) (core.Resolver, error) {
+		return &testRemote{}, nil
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.NoError(t, err)
+
+	b, err := json.Marshal(res)
+	assert.NoError(t, err)
+
+	var v struct {
+		Extensions struct {
+			Tracing struct {
+				Version   int   `json:"version"`
+				Duration  int64 `json:"duration"`
+				Execution struct {
+					Resolvers []struct {
+						Path       []string `json:"path"`
+						ParentType string   `json:"parentType"`
+						Duration   int64    `json:"duration"`
+					} `json:"resolvers"`
+				} `json:"execution"`
+			} `json:"tracing"`
+		} `json:"extensions"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &v))
+
+	tr := v.Extensions.Tracing
+	assert.Equal(t, 1, tr.Version)
+	assert.NotZero(t, tr.Duration)
+
+	paths := make([][]string, 0, len(tr.Execution.Resolvers))
+	for _, r := range tr.Execution.Resolvers {
+		paths = append(paths, r.Path)
+	}
+	// the remote field is traced once for all the users
+	assert.ElementsMatch(t, [][]string{{"users"}, {"users", "payments"}}, paths)
+}
+
+type testBatchRemote struct {
+	sync.Mutex
+	batches [][]string
+}
+
+func (r *testBatchRemote) Resolve(req core.ResolverReq) ([]byte, error) {
+	return nil, fmt.Errorf("resolve called for %s", req.ID)
+}
+
+func (r *testBatchRemote) ResolveBatch(req core.BatchResolverReq) (map[string]json.RawMessage, error) {
+	r.Lock()
+	r.batches = append(r.batches, req.IDs)
+	r.Unlock()
+
+	res := make(map[string]json.RawMessage, len(req.IDs))
+	for _, id := range req.IDs {
+		res[id] = json.RawMessage(`{"payment_id": "` + id + `", "amount": 100}`)
+	}
+	return res, nil
+}
+
+func TestBatchResolver(t *testing.T) {
+	gql := `query {
+		users(limit: 3, order_by: { id: asc }) {
+			id
+			payments {
+				amount
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Resolvers = []core.ResolverConfig{{
+		Name:           "payments",
+		Type:           "test_batch_remote",
+		Table:          "users",
+		Column:         "stripe_id",
+		MaxBatchSize:   2,
+		MaxConcurrency: 1,
+	}}
+
+	r := &testBatchRemote{}
+	err := conf.SetResolver("test_batch_remote", func(v core.ResolverProps) (core.Resolver, error) {
+		return r, nil
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.NoError(t, err)
+
+	exp := `{"users": [{"id": 1, "payments": {"amount": 100}}, ` +
+		`{"id": 2, "payments": {"amount": 100}}, ` +
+		`{"id": 3, "payments": {"amount": 100}}]}`
+
+	assert.JSONEq(t, exp, string(res.Data))
+
+	var n []int
+	for _, b := range r.batches {
+		n = append(n, len(b))
+	}
+	assert.ElementsMatch(t, []int{2, 1}, n)
+}
+
+func TestRemoteAPI(t *testing.T) {
+	gql := `query {
+		users(id: 1) {
+			id
+			payments {
+				amount
+			}
+		}
+	}`
+
+	var reqID, auth string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqID, auth = r.Header.Get("X-Request-Id"), r.Header.Get("Authorization")
+		fmt.Fprintf(w, `{"data": {"id": %q, "amount": 100}}`, path.Base(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Resolvers = []core.ResolverConfig{{
+		Name:      "payments",
+		Type:      "remote_api",
+		Table:     "users",
+		Column:    "stripe_id",
+		StripPath: "data",
+		Props: core.ResolverProps{
+			"url":          ts.URL + "/payments/$id",
+			"timeout":      "2s",
+			"headers":      map[string]interface{}{"Authorization": "Bearer 1234"},
+			"pass_headers": []interface{}{"X-Request-Id"},
+		},
+	}}
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	rc := &core.ReqConfig{Header: http.Header{"X-Request-Id": {"req-1"}}}
+
+	res, err := gj.GraphQL(context.Background(), gql, nil, rc)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"users": {"id": 1, "payments": {"amount": 100}}}`, string(res.Data))
+	assert.Equal(t, "req-1", reqID)
+	assert.Equal(t, "Bearer 1234", auth)
+
+	conf.Resolvers[0].Props["max_size"] = 10
+
+	gj, err = core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err = gj.GraphQL(context.Background(), gql, nil, rc)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"users": {"id": 1, "payments": null}}`, string(res.Data))
+	assert.Len(t, res.Errors, 1)
+}
+
+type testFailingRemote struct{}
+
+func (r *testFailingRemote) Resolve(req core.ResolverReq) ([]byte, error) {
+	return nil, errors.New("payment service unavailable")
+}
+
+func TestRemoteJoinPartialResult(t *testing.T) {
+	gql := `query {
+		users(id: 1) {
+			id
+			email
+			payments {
+				amount
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Resolvers = []core.ResolverConfig{{
+		Name:   "payments",
+		Type:   "test_failing_remote",
+		Table:  "users",
+		Column: "stripe_id",
+	}}
+
+	err := conf.SetResolver("test_failing_remote", func(v core.ResolverProps) (core.Resolver, error) {
+		return &testFailingRemote{}, nil
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.NoError(t, err)
+
+	exp := `{"users": {"id": 1, "email": "user1@test.com", "payments": null}}`
+	assert.JSONEq(t, exp, string(res.Data))
+
+	if assert.Len(t, res.Errors, 1) {
+		assert.ErrorIs(t, &res.Errors[0], core.ErrRemoteJoin)
+		assert.Equal(t, core.CodeRemoteJoinFailed, res.Errors[0].Extensions.Code)
+		assert.Equal(t, []string{"users", "payments"}, res.Errors[0].Path)
+	}
+
+	// a single error is added for all the failed ids
+	res, err = gj.GraphQL(context.Background(), `query {
+		users(limit: 3, order_by: { id: asc }) {
+			id
+			payments {
+				amount
+			}
+		}
+	}`, nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, res.Errors, 1)
+
+	// a strict resolver fails the whole request
+	conf.Resolvers[0].Strict = true
+
+	gj, err = core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	_, err = gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.ErrorIs(t, err, core.ErrRemoteJoin)
+}
+
+type testArgsRemote struct {
+	args map[string]interface{}
+}
+
+func (r *testArgsRemote) Resolve(req core.ResolverReq) ([]byte, error) {
+	r.args = req.Args
+	return []byte(`{"amount": 100, "card": {"last4": "4242", "brand": "visa"}}`), nil
+}
+
+func TestRemoteJoinArgs(t *testing.T) {
+	gql := `query {
+		users(id: 1) {
+			id
+			payments(currency: "usd", live: true, limit: $limit) {
+				amount
+				card {
+					last4
+				}
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Resolvers = []core.ResolverConfig{{
+		Name:   "payments",
+		Type:   "test_args_remote",
+		Table:  "users",
+		Column: "stripe_id",
+	}}
+
+	r := &testArgsRemote{}
+	err := conf.SetResolver("test_args_remote", func(v core.ResolverProps) (core.Resolver, error) {
+		return r, nil
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	vars := json.RawMessage(`{"limit": 5}`)
+
+	res, err := gj.GraphQL(context.Background(), gql, vars, nil)
+	assert.NoError(t, err)
+
+	exp := `{"users": {"id": 1, "payments": {"amount": 100, "card": {"last4": "4242"}}}}`
+	assert.JSONEq(t, exp, string(res.Data))
+
+	assert.Equal(t, map[string]interface{}{
+		"currency": "usd",
+		"live":     true,
+		"limit":    int64(5),
+	}, r.args)
+}
+
+type testCountingRemote struct {
+	calls int32
+}
+
+func (r *testCountingRemote) Resolve(req core.ResolverReq) ([]byte, error) {
+	atomic.AddInt32(&r.calls, 1)
+	return []byte(`{"payment_id": "` + req.ID + `", "amount": 100}`), nil
+}
+
+func TestResolverCache(t *testing.T) {
+	gql := `query {
+		users(id: 1) {
+			id
+			payments {
+				amount
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Resolvers = []core.ResolverConfig{{
+		Name:      "payments",
+		Type:      "test_counting_remote",
+		Table:     "users",
+		Column:    "stripe_id",
+		CacheTTL:  time.Minute,
+		CacheSize: 10,
+		Props:     core.ResolverProps{"pass_headers": []interface{}{"Authorization"}},
+	}}
+
+	r := &testCountingRemote{}
+	err := conf.SetResolver("test_counting_remote", func(v core.ResolverProps) (core.Resolver, error) {
+		return r, nil
+	})
+	assert.NoError(t, err)
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	rc := &core.ReqConfig{Header: http.Header{"Authorization": {"Bearer 1"}}}
+
+	for i := 0; i < 2; i++ {
+		res, err := gj.GraphQL(context.Background(), gql, nil, rc)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"users": {"id": 1, "payments": {"amount": 100}}}`, string(res.Data))
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&r.calls))
+
+	// responses are not shared across different passed through headers
+	rc = &core.ReqConfig{Header: http.Header{"Authorization": {"Bearer 2"}}}
+
+	_, err = gj.GraphQL(context.Background(), gql, nil, rc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&r.calls))
+	assert.Equal(t, map[string]core.ResolverCacheStats{
+		"payments": {Hits: 1, Misses: 2},
+	}, gj.ResolverCacheStats())
+
+	// the cache and its counts are kept across a reload
+	err = gj.Reload()
+	assert.NoError(t, err)
+
+	_, err = gj.GraphQL(context.Background(), gql, nil, rc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&r.calls))
+	assert.Equal(t, map[string]core.ResolverCacheStats{
+		"payments": {Hits: 2, Misses: 2},
+	}, gj.ResolverCacheStats())
+}
+
+type testObserver struct {
+	sync.Mutex
+	events []string
+	attrs  map[core.Event]core.Attrs
+}
+
+type testSpan struct {
+	o  *testObserver
+	ev core.Event
+	a  core.Attrs
+}
+
+func (o *testObserver) Start(c context.Context, ev core.Event, a core.Attrs) (context.Context, core.Span) {
+	return c, &testSpan{o: o, ev: ev, a: a}
+}
+
+func (s *testSpan) End(a core.Attrs, err error) {
+	s.o.Lock()
+	defer s.o.Unlock()
+
+	if s.o.attrs == nil {
+		s.o.attrs = make(map[core.Event]core.Attrs)
+	}
+	s.o.events = append(s.o.events, string(s.ev))
+	s.o.attrs[s.ev] = s.a
+}
+
+func TestObserver(t *testing.T) {
+	gql := `query getProducts {
+		products(limit: 2) {
+			id
+		}
+	}`
+
+	obs := &testObserver{}
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool, core.WithObserver(obs))
+	assert.NoError(t, err)
+
+	_, err = gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		string(core.EventQCodeCompile),
+		string(core.EventPSQLCompile),
+		string(core.EventDBQuery),
+	}, obs.events)
+
+	a := obs.attrs[core.EventDBQuery]
+	assert.Equal(t, "getProducts", a.OpName)
+	assert.Equal(t, "anon", a.Role)
+	assert.Equal(t, []string{"products"}, a.Tables())
+	assert.NotEmpty(t, a.SQL)
+}
+
+func TestQueryLimits(t *testing.T) {
+	gql := `query {
+		products(limit: 50) {
+			id
+			customer(limit: 50) {
+				id
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Limits = core.Limits{MaxDepth: 5, MaxCost: 1000}
+	conf.Roles = append(conf.Roles, core.Role{Name: "user", Limits: core.Limits{MaxCost: 5000}})
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.ErrorIs(t, err, core.ErrValidation)
+	assert.Equal(t, core.CodeTooComplex, res.Errors[0].Extensions.Code)
+
+	ctx := context.WithValue(context.Background(), core.UserIDKey, 3)
+	_, err = gj.GraphQL(ctx, gql, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestQueryLimitVar(t *testing.T) {
+	gql := `query {
+		products(limit: $n) {
+			id
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.Limits = core.Limits{MaxLimit: 10}
+
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	_, err = gj.GraphQL(context.Background(), gql, json.RawMessage(`{"n": 5}`), nil)
+	assert.NoError(t, err)
+
+	res, err := gj.GraphQL(context.Background(), gql, json.RawMessage(`{"n": 1000000}`), nil)
+	assert.ErrorIs(t, err, core.ErrValidation)
+	assert.Equal(t, core.CodeTooComplex, res.Errors[0].Extensions.Code)
+}
+
+func TestStatementTimeout(t *testing.T) {
+	gql := `query {
+		products {
+			id
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	rc := &core.ReqConfig{StatementTimeout: time.Nanosecond}
+	res, err := gj.GraphQL(context.Background(), gql, nil, rc)
+	assert.ErrorIs(t, err, core.ErrTimeout)
+	assert.Equal(t, core.CodeTimeout, res.Errors[0].Extensions.Code)
+
+	rc.StatementTimeout = 10 * time.Second
+	_, err = gj.GraphQL(context.Background(), gql, nil, rc)
+	assert.NoError(t, err)
+
+	// the timeout also applies to the role query
+	obs := &testObserver{}
+
+	conf = newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	conf.RolesQuery = `SELECT * FROM users WHERE id = $user_id`
+	conf.Roles = []core.Role{{Name: "disabled_user", Match: "disabled = true"}}
+
+	gj, err = core.NewGraphJin(conf, pool, core.WithObserver(obs))
+	assert.NoError(t, err)
+
+	ctx := context.WithValue(context.Background(), core.UserIDKey, 1)
+	rc.StatementTimeout = time.Nanosecond
+
+	_, err = gj.GraphQL(ctx, gql, nil, rc)
+	assert.ErrorIs(t, err, core.ErrTimeout)
+
+	obs.Lock()
+	defer obs.Unlock()
+	assert.Contains(t, obs.events, string(core.EventRoleQuery))
+	assert.NotContains(t, obs.events, string(core.EventDBQuery))
+}
+
+func TestExplain(t *testing.T) {
+	gql := `query {
+		products(limit: $limit) {
+			id
+			name
+		}
+	}`
+
+	vars := json.RawMessage(`{ "limit": 5 }`)
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	if dbType != "postgres" {
+		_, err := gj.Explain(context.Background(), gql, vars, nil)
+		assert.Error(t, err)
+		return
+	}
+
+	res, err := gj.Explain(context.Background(), gql, vars, &core.ExplainOpts{Analyze: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "anon", res.Role)
+	assert.Contains(t, res.SQL, `"products"`)
+	assert.Equal(t, []interface{}{"5"}, res.Params)
+
+	var plan []struct {
+		Plan          map[string]interface{} `json:"Plan"`
+		ExecutionTime float64                `json:"Execution Time"`
+	}
+	assert.NoError(t, json.Unmarshal(res.Plan, &plan))
+	assert.NotEmpty(t, plan[0].Plan["Node Type"])
+	assert.NotZero(t, plan[0].ExecutionTime)
+}
+
+func TestCompile(t *testing.T) {
+	gql := `query getProducts {
+		products(limit: $limit, where: { id: { in: $ids } }) {
+			id
+			user {
+				id
+			}
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	cq, err := gj.Compile(gql, nil, "user")
+	assert.NoError(t, err)
+	assert.Equal(t, core.OpQuery, cq.Op)
+	assert.Equal(t, "getProducts", cq.Name)
+	assert.NotEmpty(t, cq.SQL)
+	assert.Equal(t, []string{"products", "users"}, cq.Tables)
+
+	if dbType == "postgres" {
+		assert.Equal(t, []core.Param{
+			{Name: "ids", Type: "bigint", IsArray: true},
+			{Name: "limit", Type: "integer"},
+		}, cq.Params)
+	}
+
+	// tables written to by a nested insert are included even if not selected
+	cq, err = gj.Compile(`mutation {
+		users(insert: $data) {
+			id
+		}
+	}`, json.RawMessage(`{"data": {"email": "a@b.com", "products": [{"name": "p"}]}}`), "user")
+	assert.NoError(t, err)
+	assert.Equal(t, core.OpMutation, cq.Op)
+	assert.ElementsMatch(t, []string{"users", "products"}, cq.Tables)
+
+	_, err = gj.Compile(`query { products { unknown_column } }`, nil, "")
+	assert.ErrorIs(t, err, core.ErrValidation)
+}
+
+func TestReadReplicas(t *testing.T) {
+	c := context.Background()
+
+	replica, err := pgxpool.ConnectConfig(c, pool.Config())
+	assert.NoError(t, err)
+	defer replica.Close()
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true})
+	gj, err := core.NewGraphJin(conf, pool, core.WithReplicas(replica))
+	assert.NoError(t, err)
+
+	gql := `query {
+		products(limit: 1) {
+			id
+		}
+	}`
+
+	n := replica.Stat().AcquireCount()
+
+	_, err = gj.GraphQL(c, gql, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, n+1, replica.Stat().AcquireCount())
+
+	_, err = gj.GraphQL(c, gql, nil, &core.ReqConfig{UsePrimary: true})
+	assert.NoError(t, err)
+	assert.Equal(t, n+1, replica.Stat().AcquireCount())
+
+	// fails with a constraint violation so no data is changed
+	ctx := context.WithValue(c, core.UserIDKey, 3)
+	_, err = gj.GraphQL(ctx, `mutation {
+		users(insert: $data) {
+			id
+		}
+	}`, json.RawMessage(`{"data": {"id": 1, "email": "user1@test.com"}}`), nil)
+	assert.ErrorIs(t, err, core.ErrConstraintViolation)
+	assert.Equal(t, n+1, replica.Stat().AcquireCount())
+}
+
+func TestTenantSchema(t *testing.T) {
+	if dbType != "postgres" {
+		t.SkipNow()
+	}
+
+	conf := newConfig(&core.Config{
+		DBType:           dbType,
+		DisableAllowList: true,
+		Tenants:          []string{"public"},
+		TenantPattern:    `tenant_[0-9]+`,
+	})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	// a second tenant schema with different products
+	_, err = pool.Exec(context.Background(), `
+		DROP SCHEMA IF EXISTS tenant_1 CASCADE;
+		CREATE SCHEMA tenant_1;
+		CREATE TABLE tenant_1.products (LIKE public.products INCLUDING DEFAULTS);
+		INSERT INTO tenant_1.products SELECT * FROM public.products WHERE id IN (5, 6);`)
+	assert.NoError(t, err)
+	defer pool.Exec(context.Background(), `DROP SCHEMA tenant_1 CASCADE; RESET search_path`) //nolint: errcheck
+
+	gql := `query {
+		products(limit: 2, order_by: { id: asc }) {
+			id
+		}
+	}`
+
+	c := context.WithValue(context.Background(), core.TenantKey, "public")
+	res, err := gj.GraphQL(c, gql, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": [{"id": 1}, {"id": 2}]}`, string(res.Data))
+
+	c = context.WithValue(context.Background(), core.TenantKey, "tenant_1")
+	res, err = gj.GraphQL(c, gql, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": [{"id": 5}, {"id": 6}]}`, string(res.Data))
+
+	// each request sets the search path of the pooled connection
+	c = context.WithValue(context.Background(), core.TenantKey, "public")
+	res, err = gj.GraphQL(c, gql, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": [{"id": 1}, {"id": 2}]}`, string(res.Data))
+
+	c = context.WithValue(context.Background(), core.TenantKey, "other")
+	_, err = gj.GraphQL(c, gql, nil, nil)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+
+	c = context.WithValue(context.Background(), core.TenantKey, `tenant_1"; drop`)
+	_, err = gj.GraphQL(c, gql, nil, nil)
+	assert.ErrorIs(t, err, core.ErrForbidden)
+}
+
+func TestTenantColumn(t *testing.T) {
+	conf := newConfig(&core.Config{
+		DBType:           dbType,
+		DisableAllowList: true,
+		TenantColumn:     "user_id",
+	})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	c := context.WithValue(context.Background(), core.TenantIDKey, 3)
+
+	res, err := gj.GraphQL(c, `query {
+		products(limit: 5, order_by: { id: asc }) {
+			id
+		}
+	}`, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": [{"id": 3}]}`, string(res.Data))
+
+	// the tenant filter is also added to related tables
+	res, err = gj.GraphQL(c, `query {
+		users(id: 4) {
+			id
+			products {
+				id
+			}
+		}
+	}`, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"users": {"id": 4, "products": []}}`, string(res.Data))
+
+	_, err = gj.GraphQL(context.Background(), `query {
+		products {
+			id
+		}
+	}`, nil, nil)
+	assert.Error(t, err)
+
+	// a user variable named tenant_id is not replaced by the context value
+	res, err = gj.GraphQL(c, `query {
+		products(where: { id: { eq: $tenant_id } }) {
+			id
+		}
+	}`, json.RawMessage(`{"tenant_id": 3}`), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": [{"id": 3}]}`, string(res.Data))
+
+	res, err = gj.GraphQL(c, `query {
+		products(where: { id: { eq: $tenant_id } }) {
+			id
+		}
+	}`, json.RawMessage(`{"tenant_id": 4}`), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": []}`, string(res.Data))
+}
+
+func TestReloadAllowList(t *testing.T) {
+	gql := `query getUsersByID {
+		users(id: $id) {
+			id
+		}
+	}`
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: false})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	vars := json.RawMessage(`{ "id": 2 }`)
+
+	_, err = gj.GraphQL(context.Background(), gql, vars, nil)
+	assert.ErrorIs(t, err, core.ErrNotInAllowList)
+
+	fn := "./allow-list/queries/getUsersByID.yaml"
+	err = os.WriteFile(fn, []byte("name: getUsersByID\nquery: "+
+		"query getUsersByID { users(id: $id) { id } }\n"), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(fn)
+
+	assert.NoError(t, gj.ReloadAllowList())
+
+	res, err := gj.GraphQL(context.Background(), gql, vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"users": {"id": 2}}`, string(res.Data))
+
+	// an invalid query keeps the current allow list
+	fn1 := "./allow-list/queries/badQuery.yaml"
+	err = os.WriteFile(fn1, []byte("name: badQuery\nquery: query badQuery { users { id }\n"), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(fn1)
+
+	assert.Error(t, gj.ReloadAllowList())
+
+	res, err = gj.GraphQL(context.Background(), gql, vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"users": {"id": 2}}`, string(res.Data))
+	assert.NoError(t, os.Remove(fn1))
+
+	// a query with an unknown column is rejected on reload
+	fn2 := "./allow-list/queries/unknownColumn.yaml"
+	err = os.WriteFile(fn2, []byte("name: unknownColumn\nquery: "+
+		"query unknownColumn { users { id no_such_column } }\n"), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(fn2)
+
+	err = gj.ReloadAllowList()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no_such_column")
+
+	res, err = gj.GraphQL(context.Background(), gql, vars, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"users": {"id": 2}}`, string(res.Data))
+}
+
+func TestResultCache(t *testing.T) {
+	gql := `query getProducts @cacheControl(maxAge: 60) {
+		products(id: 2) {
+			id
+			name
+		}
+	}`
+
+	obs := &testObserver{}
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true, EnableResultCache: true})
+	gj, err := core.NewGraphJin(conf, pool, core.WithObserver(obs))
+	assert.NoError(t, err)
+
+	dbQueries := func() (n int) {
+		obs.Lock()
+		defer obs.Unlock()
+		for _, ev := range obs.events {
+			if ev == string(core.EventDBQuery) {
+				n++
+			}
+		}
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"products": {"id": 2, "name": "Product 2"}}`, string(res.Data))
+		assert.Equal(t, "max-age=60", res.CacheControl())
+	}
+	assert.Equal(t, 1, dbQueries())
+
+	// a mutation on the products table removes the cached result
+	c := context.WithValue(context.Background(), core.UserIDKey, 2)
+
+	tx, err := pool.Begin(c)
+	assert.NoError(t, err)
+	defer tx.Rollback(c) //nolint: errcheck
+
+	_, err = gj.GraphQLTx(c, tx, `mutation {
+		products(id: 2, update: $data) {
+			id
+		}
+	}`, json.RawMessage(`{"data": {"name": "Product 2"}}`), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback(c))
+
+	_, err = gj.GraphQL(context.Background(), gql, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, dbQueries())
+}
+
+func TestResultCacheReloadAllowList(t *testing.T) {
+	gql := `query getCachedProduct @cacheControl(maxAge: 60) {
+		products(id: 2) {
+			id
+			name
+		}
+	}`
+
+	obs := &testObserver{}
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: false, EnableResultCache: true})
+	gj, err := core.NewGraphJin(conf, pool, core.WithObserver(obs))
+	assert.NoError(t, err)
+
+	fn := "./allow-list/queries/getCachedProduct.yaml"
+	err = os.WriteFile(fn, []byte("name: getCachedProduct\nquery: |-\n"+
+		"  query getCachedProduct @cacheControl(maxAge: 60) { products(id: 2) { id name } }\n"), 0600)
+	assert.NoError(t, err)
+	defer os.Remove(fn)
+
+	// the result cache is kept on reload
+	assert.NoError(t, gj.ReloadAllowList())
+
+	for i := 0; i < 2; i++ {
+		res, err := gj.GraphQL(context.Background(), gql, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"products": {"id": 2, "name": "Product 2"}}`, string(res.Data))
+	}
+
+	obs.Lock()
+	defer obs.Unlock()
+
+	n := 0
+	for _, ev := range obs.events {
+		if ev == string(core.EventDBQuery) {
+			n++
+		}
+	}
+	assert.Equal(t, 1, n)
+}
+
+func TestResultCacheAPQ(t *testing.T) {
+	for _, q := range []struct{ name, id string }{{"getCachedProductA", "2"}, {"getCachedProductB", "3"}} {
+		fn := "./allow-list/queries/" + q.name + ".yaml"
+		err := os.WriteFile(fn, []byte("name: "+q.name+"\nquery: |-\n  query "+q.name+
+			" @cacheControl(maxAge: 60) { products(id: "+q.id+") { id } }\n"), 0600)
+		assert.NoError(t, err)
+		defer os.Remove(fn)
+	}
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: false, EnableResultCache: true})
+	gj, err := core.NewGraphJin(conf, pool)
+	assert.NoError(t, err)
+
+	// persisted queries run by the APQ key alone are cached separately
+	res, err := gj.GraphQL(context.Background(), "", nil, &core.ReqConfig{APQKey: "getCachedProductA"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": {"id": 2}}`, string(res.Data))
+
+	res, err = gj.GraphQL(context.Background(), "", nil, &core.ReqConfig{APQKey: "getCachedProductB"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"products": {"id": 3}}`, string(res.Data))
+}
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRemoteTimeout = 10 * time.Second
+	defaultRemoteMaxSize = 10 << 20 // 10MB
+)
+
+// remoteAPI is the built-in resolver type `remote_api` it fetches the remote
+// data using a GET request to the url with `$id` replaced by the id. Arguments
+// on the remote field are added to the url as query parameters.
+//
+// Example config:
+/*
+	resolvers:
+	  - name: payments
+	    type: remote_api
+	    table: users
+	    column: stripe_id
+	    url: http://payments-service/payments/$id
+	    strip_path: data
+	    timeout: 5s
+	    retries: 2
+	    cache_ttl: 5m
+	    max_size: 1048576
+	    headers:
+	      Authorization: Bearer 1234
+	    pass_headers:
+	      - X-Request-Id
+*/
+type remoteAPI struct {
+	url         string
+	headers     map[string]string
+	passHeaders []string
+	retries     int
+	maxSize     int64
+	client      *http.Client
+}
+
+func newRemoteAPI(v ResolverProps) (*remoteAPI, error) {
+	var err error
+
+	r := &remoteAPI{
+		headers: make(map[string]string),
+		maxSize: defaultRemoteMaxSize,
+	}
+	timeout := defaultRemoteTimeout
+
+	if u, ok := v["url"].(string); ok {
+		r.url = u
+	}
+	if r.url == "" {
+		return nil, errors.New("remote_api: url required")
+	}
+
+	switch hm := v["headers"].(type) {
+	case nil:
+	case map[string]string:
+		r.headers = hm
+	case map[string]interface{}:
+		for k, hv := range hm {
+			r.headers[k] = fmt.Sprintf("%v", hv)
+		}
+	default:
+		return nil, errors.New("remote_api: headers: must be a map")
+	}
+
+	if r.passHeaders, err = passHeaders(v); err != nil {
+		return nil, fmt.Errorf("remote_api: %w", err)
+	}
+
+	if t, ok := v["timeout"]; ok {
+		if timeout, err = toDuration(t); err != nil {
+			return nil, fmt.Errorf("remote_api: timeout: %w", err)
+		}
+	}
+
+	if n, ok := v["retries"]; ok {
+		if r.retries, err = toInt(n); err != nil {
+			return nil, fmt.Errorf("remote_api: retries: %w", err)
+		}
+	}
+
+	if n, ok := v["max_size"]; ok {
+		ms, err := toInt(n)
+		if err != nil {
+			return nil, fmt.Errorf("remote_api: max_size: %w", err)
+		}
+		r.maxSize = int64(ms)
+	}
+
+	r.client = &http.Client{Timeout: timeout}
+	return r, nil
+}
+
+// Resolve fetches the remote data for the id, failed requests and
+// 5xx responses are retried up to the number of retries
+func (r *remoteAPI) Resolve(req ResolverReq) ([]byte, error) {
+	uri := strings.ReplaceAll(r.url, "$id", url.PathEscape(req.ID))
+
+	if len(req.Args) != 0 {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("remote_api: %w", err)
+		}
+		u.RawQuery = argsQuery(u.Query(), req.Args).Encode()
+		uri = u.String()
+	}
+
+	var b []byte
+	var err error
+
+	for i := 0; i <= r.retries; i++ {
+		if i != 0 {
+			time.Sleep(time.Duration(i) * 100 * time.Millisecond)
+		}
+
+		var retry bool
+		if b, retry, err = r.get(uri, req.ReqConfig); err == nil || !retry {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("remote_api: %w", err)
+	}
+	return b, nil
+}
+
+// get makes the request and returns the response body, the bool is
+// true if the request failed with an error that can be retried
+func (r *remoteAPI) get(uri string, rc *ReqConfig) ([]byte, bool, error) {
+	hreq, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for k, v := range r.headers {
+		hreq.Header.Set(k, v)
+	}
+
+	if rc != nil && rc.Header != nil {
+		for _, k := range r.passHeaders {
+			if v := rc.Header.Get(k); v != "" {
+				hreq.Header.Set(k, v)
+			}
+		}
+	}
+
+	res, err := r.client.Do(hreq)
+	if err != nil {
+		return nil, true, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, res.StatusCode >= 500,
+			fmt.Errorf("%s: unexpected status: %s", uri, res.Status)
+	}
+
+	if res.ContentLength > r.maxSize {
+		return nil, false, fmt.Errorf("%s: response larger than %d bytes", uri, r.maxSize)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, r.maxSize+1))
+	if err != nil {
+		return nil, true, err
+	}
+
+	if int64(len(b)) > r.maxSize {
+		return nil, false, fmt.Errorf("%s: response larger than %d bytes", uri, r.maxSize)
+	}
+
+	return b, false, nil
+}
+
+// argsQuery adds the arguments to the query parameters,
+// lists are added as multiple values of the parameter
+func argsQuery(q url.Values, args map[string]interface{}) url.Values {
+	for k, v := range args {
+		switch v1 := v.(type) {
+		case nil:
+		case []interface{}:
+			for _, v2 := range v1 {
+				q.Add(k, fmt.Sprintf("%v", v2))
+			}
+		default:
+			q.Set(k, fmt.Sprintf("%v", v1))
+		}
+	}
+	return q
+}
+
+// passHeaders returns the request headers passed through to the remote API
+func passHeaders(v ResolverProps) ([]string, error) {
+	var hl []string
+
+	switch pl := v["pass_headers"].(type) {
+	case nil:
+	case []string:
+		hl = pl
+	case []interface{}:
+		for _, h := range pl {
+			hl = append(hl, fmt.Sprintf("%v", h))
+		}
+	default:
+		return nil, errors.New("pass_headers: must be a list")
+	}
+	return hl, nil
+}
+
+func toInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	}
+	return 0, errors.New("must be a number")
+}
+
+// toDuration parses a duration string (eg. 5s) or a number of seconds
+func toDuration(v interface{}) (time.Duration, error) {
+	if s, ok := v.(string); ok {
+		return time.ParseDuration(s)
+	}
+	n, err := toInt(v)
+	if err != nil {
+		return 0, errors.New("must be a duration")
+	}
+	return time.Duration(n) * time.Second, nil
+}
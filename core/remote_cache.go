@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ResolverCache is the store used to cache the responses of remote resolvers
+// that have a `cache_ttl` set. Entries must expire after the ttl. Use
+// NewLRUResolverCache for an in-process cache.
+type ResolverCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, val []byte, ttl time.Duration)
+}
+
+// ResolverCacheStats are the cache hits and misses of a remote resolver
+type ResolverCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// WithResolverCache sets the store shared by all remote resolvers with a
+// `cache_ttl`, by default each resolver gets an in-process LRU cache
+// with `cache_size` entries
+func WithResolverCache(rc ResolverCache) Option {
+	return func(gj *graphjin) error {
+		gj.rescache = rc
+		return nil
+	}
+}
+
+// NewLRUResolverCache returns an in-process LRU cache with a max
+// number of entries to be used with WithResolverCache
+func NewLRUResolverCache(size int) (ResolverCache, error) {
+	rc, err := NewLRUResultCache(size)
+	if err != nil {
+		return nil, err
+	}
+	return lruResolverCache{rc}, nil
+}
+
+type lruResolverCache struct {
+	rc ResultCache
+}
+
+func (c lruResolverCache) Get(key string) ([]byte, bool) {
+	return c.rc.Get(key)
+}
+
+func (c lruResolverCache) Set(key string, val []byte, ttl time.Duration) {
+	c.rc.Set(key, val, nil, ttl)
+}
+
+type resCache struct {
+	name    string
+	store   ResolverCache
+	ttl     time.Duration
+	size    int
+	headers []string
+	hits    uint64
+	misses  uint64
+}
+
+// withResCaches passes the resolver caches of the instance being reloaded
+// so the new one keeps their entries and counts
+func withResCaches(old *graphjin) Option {
+	return func(gj *graphjin) error {
+		gj.prevRes = make(map[string]*resCache)
+		for _, r := range old.rmap {
+			if r.Cache != nil {
+				gj.prevRes[r.Cache.name] = r.Cache
+			}
+		}
+		return nil
+	}
+}
+
+func (gj *graphjin) newResCache(rc ResolverConfig) (*resCache, error) {
+	if rc.CacheTTL <= 0 {
+		return nil, nil
+	}
+
+	c := &resCache{name: rc.Name, store: gj.rescache, ttl: rc.CacheTTL, size: rc.CacheSize}
+
+	// the response can depend on the headers passed through (eg. Authorization)
+	// so their values are part of the key to not share it across users
+	var err error
+	if c.headers, err = passHeaders(rc.Props); err != nil {
+		return nil, err
+	}
+
+	// reuse the cache from before a reload if its config is unchanged
+	if pc, ok := gj.prevRes[rc.Name]; ok && pc.sameAs(c) {
+		return pc, nil
+	}
+
+	if c.store == nil {
+		size := rc.CacheSize
+		if size == 0 {
+			size = 1000
+		}
+
+		if c.store, err = NewLRUResolverCache(size); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *resCache) sameAs(c1 *resCache) bool {
+	if c.ttl != c1.ttl || c.size != c1.size || len(c.headers) != len(c1.headers) {
+		return false
+	}
+	for i := range c.headers {
+		if c.headers[i] != c1.headers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns the cache key for the remote data of the id, it includes
+// the arguments and the values of the headers passed through
+func (c *resCache) key(id string, args map[string]interface{}, rc *ReqConfig) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s:%s", c.name, id)
+
+	if len(args) != 0 {
+		// maps are printed sorted by key
+		fmt.Fprintf(&sb, ":%v", args)
+	}
+
+	for _, h := range c.headers {
+		var v string
+		if rc != nil {
+			v = rc.Header.Get(h)
+		}
+		fmt.Fprintf(&sb, ":%q", v)
+	}
+	return sb.String()
+}
+
+func (c *resCache) get(id string, args map[string]interface{}, rc *ReqConfig) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	b, ok := c.store.Get(c.key(id, args, rc))
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return b, ok
+}
+
+func (c *resCache) set(id string, args map[string]interface{}, rc *ReqConfig, val []byte) {
+	if c == nil {
+		return
+	}
+	c.store.Set(c.key(id, args, rc), val, c.ttl)
+}
+
+// ResolverCacheStats returns the cache hits and misses of each of the remote
+// resolvers with a `cache_ttl` set, keyed by resolver name. The caches and
+// their counts are kept on Reload unless the resolver's cache config changed
+func (g *GraphJin) ResolverCacheStats() map[string]ResolverCacheStats {
+	gj := g.Load().(*graphjin)
+
+	stats := make(map[string]ResolverCacheStats)
+
+	for _, r := range gj.rmap {
+		if r.Cache == nil {
+			continue
+		}
+		stats[r.Cache.name] = ResolverCacheStats{
+			Hits:   atomic.LoadUint64(&r.Cache.hits),
+			Misses: atomic.LoadUint64(&r.Cache.misses),
+		}
+	}
+	return stats
+}
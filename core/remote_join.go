@@ -8,9 +8,10 @@ import (
 
 	"github.com/dosco/graphjin/core/internal/qcode"
 	"github.com/dosco/graphjin/internal/jsn"
+	"github.com/goccy/go-json"
 )
 
-func (c *gcontext) execRemoteJoin(res queryResp) (queryResp, error) {
+func (c *gcontext) execRemoteJoin(res queryResp, vars []byte) (queryResp, error) {
 	var err error
 	sel := res.qc.st.qc.Selects
 
@@ -31,7 +32,10 @@ func (c *gcontext) execRemoteJoin(res queryResp) (queryResp, error) {
 		return res, errors.New("something wrong no remote ids found in db response")
 	}
 
-	to, err = c.resolveRemotes(from, sel, sfmap)
+	_, sp := c.gj.start(c, EventRemoteJoin, Attrs{OpName: c.name, Role: res.role, qc: res.qc.st.qc})
+	to, res.errs, err = c.resolveRemotes(from, sel, sfmap, vars)
+	sp.End(Attrs{}, err)
+
 	if err != nil {
 		return res, err
 	}
@@ -47,75 +51,283 @@ func (c *gcontext) execRemoteJoin(res queryResp) (queryResp, error) {
 	return res, nil
 }
 
+// resolveRemotes returns the remote data for each of the insertion points.
+// Fields that fail to resolve are set to null and returned as errors unless
+// the resolver is strict, then the error fails the whole request
 func (c *gcontext) resolveRemotes(
 	from []jsn.Field,
 	sel []qcode.Select,
-	sfmap map[string]*qcode.Select) ([]jsn.Field, error) {
+	sfmap map[string]*qcode.Select,
+	vars []byte) ([]jsn.Field, []Error, error) {
 
 	// replacement data for the marked insertion points
 	// key and value will be replaced by whats below
 	to := make([]jsn.Field, len(from))
 
-	var wg sync.WaitGroup
-	wg.Add(len(from))
-
-	var cerr error
+	// group the insertion points by resolver so batch resolvers
+	// can fetch all the ids in a single call
+	var groups []*remoteGroup
+	gmap := make(map[string]*remoteGroup)
 
 	for i, id := range from {
 		// use the json key to find the related Select object
 		s, ok := sfmap[string(id.Key)]
 		if !ok {
-			return nil, fmt.Errorf("invalid remote field key")
+			return nil, nil, fmt.Errorf("invalid remote field key")
 		}
 		p := sel[s.ParentID]
 
 		// then use the Table name in the Select and it's parent
 		// to find the resolver to use for this relationship
-		r, ok := c.gj.rmap[(s.Table + p.Table)]
+		k := s.Table + p.Table
+		r, ok := c.gj.rmap[k]
 		if !ok {
-			return nil, fmt.Errorf("no resolver found")
+			return nil, nil, fmt.Errorf("no resolver found")
 		}
 
 		id := jsn.Value(id.Value)
 		if len(id) == 0 {
-			return nil, fmt.Errorf("invalid remote field id")
+			return nil, nil, fmt.Errorf("invalid remote field id")
 		}
 
-		go func(n int, id []byte, s *qcode.Select) {
-			defer wg.Done()
+		g, ok := gmap[k]
+		if !ok {
+			args, err := remoteArgs(s.RemoteArgs, vars)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", s.Table, err)
+			}
+			g = &remoteGroup{r: r, s: s, ptable: p.Table, args: args, im: make(map[string][]int)}
+			gmap[k] = g
+			groups = append(groups, g)
+		}
+		g.add(string(id), i)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []Error
+	var cerr error
 
-			//st := time.Now()
+	// fail sets the failed insertion points to null and adds the error once
+	// per remote field, with a strict resolver the first error fails the request
+	fail := func(g *remoteGroup, err error, ns ...int) {
+		err = &kindError{kind: ErrRemoteJoin, err: fmt.Errorf("%s: %w", g.s.Table, err)}
 
-			b, err := r.Fn.Resolve(ResolverReq{
-				ID: string(id), Sel: s, Log: c.gj.log, ReqConfig: c.rc})
-			if err != nil {
-				cerr = fmt.Errorf("%s: %s", s.Table, err)
+		mu.Lock()
+		defer mu.Unlock()
+
+		if g.r.Strict {
+			if cerr == nil {
+				cerr = err
+			}
+			return
+		}
+
+		for _, n := range ns {
+			to[n] = jsn.Field{Key: []byte(g.s.FieldName), Value: []byte("null")}
+		}
+
+		if g.failed {
+			return
+		}
+		g.failed = true
+
+		e := newError(err)
+		e.Path = selectPath(sel, g.s.ID)
+		errs = append(errs, e)
+	}
+
+	for _, g := range groups {
+		g := g
+
+		// limits the number of concurrent calls to the resolver
+		var sem chan struct{}
+		if g.r.MaxConc > 0 {
+			sem = make(chan struct{}, g.r.MaxConc)
+		}
+
+		// the remote field is traced once, from the first call until all
+		// its calls are done, since the paths are the same for every id
+		var gwg sync.WaitGroup
+		st := c.tr.now()
+
+		run := func(fn func()) {
+			wg.Add(1)
+			gwg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer gwg.Done()
+				if sem != nil {
+					sem <- struct{}{}
+					defer func() { <-sem }()
+				}
+				fn()
+			}()
+		}
+
+		// called once all the calls of the remote field are started
+		trace := func() {
+			if c.tr == nil {
 				return
 			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				gwg.Wait()
+				c.tr.addResolver(sel, g.s.ID, g.ptable, st)
+			}()
+		}
 
-			if len(r.Path) != 0 {
-				b = jsn.Strip(b, r.Path)
+		if g.r.Batch == nil {
+			for j := range g.ids {
+				n, id := g.idx[j], g.ids[j]
+
+				run(func() {
+					b, ok := g.r.Cache.get(id, g.args, c.rc)
+					if !ok {
+						var err error
+						b, err = g.r.Fn.Resolve(ResolverReq{
+							ID: id, Args: g.args, Sel: g.s, Log: c.gj.log, ReqConfig: c.rc})
+						if err != nil {
+							fail(g, err, n)
+							return
+						}
+						g.r.Cache.set(id, g.args, c.rc, b)
+					}
+
+					f, err := remoteField(g.r, g.s, b)
+					if err != nil {
+						fail(g, err, n)
+						return
+					}
+					to[n] = f
+				})
 			}
+			trace()
+			continue
+		}
+
+		// ids found in the cache are not fetched
+		var miss []string
+
+		for _, id := range g.uids {
+			b, ok := g.r.Cache.get(id, g.args, c.rc)
+			if !ok {
+				miss = append(miss, id)
+				continue
+			}
+			f, err := remoteField(g.r, g.s, b)
+			if err != nil {
+				fail(g, err, g.im[id]...)
+				continue
+			}
+			for _, n := range g.im[id] {
+				to[n] = f
+			}
+		}
 
-			var ob bytes.Buffer
+		for _, ids := range g.batches(miss) {
+			ids := ids
 
-			if len(s.Cols) != 0 {
-				err = jsn.Filter(&ob, b, colsToList(s.Cols))
+			run(func() {
+				res, err := g.r.Batch.ResolveBatch(BatchResolverReq{
+					IDs: ids, Args: g.args, Sel: g.s, Log: c.gj.log, ReqConfig: c.rc})
 				if err != nil {
-					cerr = fmt.Errorf("%s: %w", s.Table, err)
+					var ns []int
+					for _, id := range ids {
+						ns = append(ns, g.im[id]...)
+					}
+					fail(g, err, ns...)
 					return
 				}
 
-			} else {
-				ob.WriteString("null")
-			}
-
-			to[n] = jsn.Field{Key: []byte(s.FieldName), Value: ob.Bytes()}
-		}(i, id, s)
+				for _, id := range ids {
+					if b, ok := res[id]; ok {
+						g.r.Cache.set(id, g.args, c.rc, b)
+					}
+					f, err := remoteField(g.r, g.s, res[id])
+					if err != nil {
+						fail(g, err, g.im[id]...)
+						continue
+					}
+					for _, n := range g.im[id] {
+						to[n] = f
+					}
+				}
+			})
+		}
+		trace()
 	}
 	wg.Wait()
 
-	return to, cerr
+	if cerr != nil {
+		return nil, nil, cerr
+	}
+	return to, errs, nil
+}
+
+// remoteGroup is the list of insertion points
+// that use the same resolver
+type remoteGroup struct {
+	r      resItem
+	s      *qcode.Select
+	ptable string
+	args   map[string]interface{}
+	ids    []string
+	idx    []int
+	uids   []string
+	im     map[string][]int
+	failed bool
+}
+
+func (g *remoteGroup) add(id string, n int) {
+	if _, ok := g.im[id]; !ok {
+		g.uids = append(g.uids, id)
+	}
+	g.im[id] = append(g.im[id], n)
+	g.ids = append(g.ids, id)
+	g.idx = append(g.idx, n)
+}
+
+// batches returns the ids split into
+// batches of the max batch size
+func (g *remoteGroup) batches(ids []string) [][]string {
+	n := g.r.MaxBatch
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if n <= 0 {
+		return [][]string{ids}
+	}
+
+	var b [][]string
+	for len(ids) > n {
+		b = append(b, ids[:n:n])
+		ids = ids[n:]
+	}
+	return append(b, ids)
+}
+
+// remoteField strips and filters the remote data to
+// the selected columns
+func remoteField(r resItem, s *qcode.Select, b []byte) (jsn.Field, error) {
+	var ob bytes.Buffer
+
+	if len(b) != 0 && len(r.Path) != 0 {
+		b = jsn.Strip(b, r.Path)
+	}
+
+	if len(b) != 0 && len(s.RemoteFields) != 0 {
+		if err := jsn.FilterKeys(&ob, b, remoteKeys(s.RemoteFields)); err != nil {
+			return jsn.Field{}, err
+		}
+	} else {
+		ob.WriteString("null")
+	}
+
+	return jsn.Field{Key: []byte(s.FieldName), Value: ob.Bytes()}, nil
 }
 
 func (c *gcontext) parentFieldIds(sel []qcode.Select, remotes int32) (
@@ -146,11 +358,105 @@ func (c *gcontext) parentFieldIds(sel []qcode.Select, remotes int32) (
 	return fm, sm, nil
 }
 
-func colsToList(cols []qcode.Column) []string {
-	var f []string
+// remoteKeys returns the keys to filter the remote data with
+func remoteKeys(fields []qcode.RemoteField) []jsn.Key {
+	keys := make([]jsn.Key, len(fields))
+
+	for i, f := range fields {
+		keys[i] = jsn.Key{Name: f.Name, Keys: remoteKeys(f.Children)}
+	}
+	return keys
+}
+
+// remoteArgs returns the arguments of the remote field with the
+// variables replaced by their values from the request variables
+func remoteArgs(args map[string]interface{}, vars []byte) (map[string]interface{}, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
 
-	for _, col := range cols {
-		f = append(f, col.FieldName)
+	var vm map[string]json.RawMessage
+
+	if len(vars) != 0 {
+		if err := json.Unmarshal(vars, &vm); err != nil {
+			return nil, err
+		}
+	}
+
+	res := make(map[string]interface{}, len(args))
+
+	for k, v := range args {
+		v1, err := remoteArgVal(v, vm)
+		if err != nil {
+			return nil, fmt.Errorf("argument '%s': %w", k, err)
+		}
+		res[k] = v1
+	}
+	return res, nil
+}
+
+func remoteArgVal(v interface{}, vm map[string]json.RawMessage) (interface{}, error) {
+	switch v1 := v.(type) {
+	case qcode.ArgVar:
+		b, ok := vm[string(v1)]
+		if !ok {
+			return nil, nil
+		}
+		var val interface{}
+
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+
+		if err := d.Decode(&val); err != nil {
+			return nil, err
+		}
+		return jsonNumbers(val), nil
+
+	case []interface{}:
+		list := make([]interface{}, len(v1))
+		for i := range v1 {
+			val, err := remoteArgVal(v1[i], vm)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = val
+		}
+		return list, nil
+
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v1))
+		for k := range v1 {
+			val, err := remoteArgVal(v1[k], vm)
+			if err != nil {
+				return nil, err
+			}
+			obj[k] = val
+		}
+		return obj, nil
+	}
+	return v, nil
+}
+
+// jsonNumbers converts the numbers in the decoded variable
+// value to an int64 or float64
+func jsonNumbers(v interface{}) interface{} {
+	switch v1 := v.(type) {
+	case json.Number:
+		if n, err := v1.Int64(); err == nil {
+			return n
+		}
+		n, _ := v1.Float64()
+		return n
+
+	case []interface{}:
+		for i := range v1 {
+			v1[i] = jsonNumbers(v1[i])
+		}
+
+	case map[string]interface{}:
+		for k := range v1 {
+			v1[k] = jsonNumbers(v1[k])
+		}
 	}
-	return f
+	return v
 }
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"sync/atomic"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// WithReplicas adds read replica pools. Queries and subscription polls are
+// load balanced across the replicas while mutations and the role query always
+// use the primary pool. Set 'UsePrimary' on the ReqConfig to force a query to
+// use the primary (eg. to read your own writes)
+func WithReplicas(pools ...*pgxpool.Pool) Option {
+	return func(gj *graphjin) error {
+		gj.replicas = pools
+		return nil
+	}
+}
+
+// readPool returns the next replica pool or the primary
+// pool if there are no replicas
+func (gj *graphjin) readPool() *pgxpool.Pool {
+	if len(gj.replicas) == 0 {
+		return gj.pool
+	}
+	n := atomic.AddUint32(&gj.rr, 1)
+	return gj.replicas[n%uint32(len(gj.replicas))]
+}
+
+// usesReplica returns true if the query can be run on a replica
+func (c *gcontext) usesReplica(op qcode.QType) bool {
+	if len(c.gj.replicas) == 0 || op != qcode.QTQuery {
+		return false
+	}
+	return c.rc == nil || !c.rc.UsePrimary
+}
@@ -10,15 +10,24 @@ import (
 type refunc func(v ResolverProps) (Resolver, error)
 
 type resItem struct {
-	IDField []byte
-	Path    [][]byte
-	Fn      Resolver
+	IDField  []byte
+	Path     [][]byte
+	Fn       Resolver
+	Batch    BatchResolver
+	MaxBatch int
+	MaxConc  int
+	Strict   bool
+	Cache    *resCache
 }
 
 func (gj *graphjin) initResolvers() error {
 	gj.rmap = make(map[string]resItem)
 
-	rtmap := make(map[string]refunc)
+	rtmap := map[string]refunc{
+		"remote_api": func(v ResolverProps) (Resolver, error) {
+			return newRemoteAPI(v)
+		},
+	}
 
 	for name, fn := range gj.conf.rtmap {
 		rtmap[name] = fn
@@ -96,9 +105,20 @@ func (gj *graphjin) initRemote(rc ResolverConfig, rtmap map[string]refunc) error
 	}
 
 	rf := resItem{
-		IDField: []byte(idk),
-		Path:    path,
-		Fn:      fn,
+		IDField:  []byte(idk),
+		Path:     path,
+		Fn:       fn,
+		MaxBatch: rc.MaxBatchSize,
+		MaxConc:  rc.MaxConcurrency,
+		Strict:   rc.Strict,
+	}
+
+	if rf.Cache, err = gj.newResCache(rc); err != nil {
+		return err
+	}
+
+	if br, ok := fn.(BatchResolver); ok {
+		rf.Batch = br
 	}
 
 	// Index resolver obj by parent and child names
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Schema renders the GraphQL schema (SDL) of the database as seen by the role.
+// This includes all tables, relationships, aliases and the singular fields.
+// Use a role like 'anon' or 'user' to see exactly what it can reach.
+func (g *GraphJin) Schema(role string) (string, error) {
+	gj := g.Load().(*graphjin)
+
+	if role == "" {
+		role = "anon"
+	}
+
+	s, err := gj.getIntroSchema(role)
+	if err != nil {
+		return "", err
+	}
+	return s.sdl(), nil
+}
+
+func (s *introSchema) sdl() string {
+	var w bytes.Buffer
+
+	w.WriteString("schema {\n")
+	w.WriteString("  query: " + s.query.name + "\n")
+	if s.mutation != nil {
+		w.WriteString("  mutation: " + s.mutation.name + "\n")
+	}
+	w.WriteString("  subscription: " + s.subscription.name + "\n")
+	w.WriteString("}\n")
+
+	for _, d := range s.directives {
+		// built-in directives are not part of the schema
+		switch d.name {
+		case "skip", "include", "deprecated", "specifiedBy":
+			continue
+		}
+
+		w.WriteByte('\n')
+		writeSDLDesc(&w, d.desc, "")
+		w.WriteString("directive @" + d.name)
+		writeSDLArgs(&w, d.args)
+		w.WriteString(" on " + strings.Join(d.locations, " | ") + "\n")
+	}
+
+	for _, t := range s.types {
+		switch t.name {
+		case "Int", "Float", "String", "Boolean", "ID":
+			continue
+		}
+
+		w.WriteByte('\n')
+		writeSDLDesc(&w, t.desc, "")
+
+		switch t.kind {
+		case kindScalar:
+			w.WriteString("scalar " + t.name + "\n")
+
+		case kindEnum:
+			w.WriteString("enum " + t.name + " {\n")
+			for _, v := range t.enumValues {
+				writeSDLDesc(&w, v.desc, "  ")
+				w.WriteString("  " + v.name + "\n")
+			}
+			w.WriteString("}\n")
+
+		case kindObject:
+			w.WriteString("type " + t.name + " {\n")
+			for _, f := range t.fields {
+				writeSDLDesc(&w, f.desc, "  ")
+				w.WriteString("  " + f.name)
+				writeSDLArgs(&w, f.args)
+				w.WriteString(": " + sdlTypeRef(f.typ) + "\n")
+			}
+			w.WriteString("}\n")
+
+		case kindInputObject:
+			w.WriteString("input " + t.name + " {\n")
+			for _, v := range t.inputFields {
+				writeSDLDesc(&w, v.desc, "  ")
+				w.WriteString("  " + sdlValue(v) + "\n")
+			}
+			w.WriteString("}\n")
+		}
+	}
+
+	return w.String()
+}
+
+func writeSDLArgs(w *bytes.Buffer, args []introValue) {
+	if len(args) == 0 {
+		return
+	}
+	w.WriteByte('(')
+	for i, v := range args {
+		if i != 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(sdlValue(v))
+	}
+	w.WriteByte(')')
+}
+
+func writeSDLDesc(w *bytes.Buffer, desc, indent string) {
+	if desc == "" {
+		return
+	}
+	w.WriteString(indent + `"""` + strings.ReplaceAll(desc, `"""`, `\"""`) + `"""` + "\n")
+}
+
+func sdlValue(v introValue) string {
+	s := v.name + ": " + sdlTypeRef(v.typ)
+	if v.defVal != "" {
+		s += " = " + v.defVal
+	}
+	return s
+}
+
+func sdlTypeRef(t *introType) string {
+	switch t.kind {
+	case kindList:
+		return "[" + sdlTypeRef(t.ofType) + "]"
+	case kindNonNull:
+		return sdlTypeRef(t.ofType) + "!"
+	}
+	return t.name
+}
@@ -24,15 +24,30 @@ const (
 	errSubs             = "subscription: %s: %s"
 )
 
+// errSubChanged is sent to the members when the subscription query
+// params change on a reload and the members have to subscribe again
+var errSubChanged = errors.New("subscription: query changed on reload, subscribe again")
+
 type sub struct {
-	name string
-	role string
-	qc   *queryComp
-	js   json.RawMessage
+	name   string
+	role   string
+	tenant string
+	query  string
+	vars   json.RawMessage
+	js     json.RawMessage
+
+	// qc is replaced when the subscription is moved on a reload
+	// and must be read using getQC outside the controller
+	qc *queryComp
+	mu sync.Mutex
 
 	add  chan *Member
 	del  chan *Member
 	updt chan mmsg
+	move chan subMove
+
+	// done is closed once the subscription stops
+	done chan struct{}
 
 	mval
 	sync.Once
@@ -52,6 +67,13 @@ type minfo struct {
 	cindx int
 }
 
+// subMove hands over a subscription to a reloaded instance, ack is
+// closed once the subscription is moved or closed
+type subMove struct {
+	gj  *graphjin
+	ack chan struct{}
+}
+
 type mmsg struct {
 	id     xid.ID
 	dh     [sha256.Size]byte
@@ -61,6 +83,8 @@ type mmsg struct {
 type Member struct {
 	params json.RawMessage
 	sub    *sub
+	// qc is the compiled query the params were built for
+	qc     *queryComp
 	Result chan *Result
 	done   bool
 	id     xid.ID
@@ -72,6 +96,19 @@ type Member struct {
 
 // GraphQLEx is the extended version of the Subscribe function allowing for request specific config.
 func (g *GraphJin) Subscribe(
+	c context.Context,
+	query string,
+	vars json.RawMessage,
+	rc *ReqConfig) (*Member, error) {
+	m, err := g.subscribe(c, query, vars, rc)
+	if err != nil {
+		e := newError(err)
+		return nil, &e
+	}
+	return m, nil
+}
+
+func (g *GraphJin) subscribe(
 	c context.Context,
 	query string,
 	vars json.RawMessage,
@@ -82,27 +119,19 @@ func (g *GraphJin) Subscribe(
 	op, name := qcode.GetQType(query)
 
 	if op != qcode.QTSubscription {
-		return nil, errors.New("subscription: not a subscription query")
+		return nil, validationError(errors.New("subscription: not a subscription query"))
 	}
 
 	if name == "" {
 		if gj.allowList != nil {
-			return nil, errors.New("subscription: query name is required")
+			return nil, validationError(errors.New("subscription: query name is required"))
 		} else {
 			h := sha256.Sum256([]byte(query))
 			name = base64.StdEncoding.EncodeToString(h[:])
 		}
 	}
 
-	var role string
-
-	if v, ok := c.Value(UserRoleKey).(string); ok {
-		role = v
-	} else if c.Value(UserIDKey) != nil {
-		role = "user"
-	} else {
-		role = "anon"
-	}
+	role := userRole(c)
 
 	if role == "user" && gj.abacEnabled {
 		if role, err = gj.executeRoleQuery(c, nil, gj.roleStmtMD, vars, rc); err != nil {
@@ -110,12 +139,20 @@ func (g *GraphJin) Subscribe(
 		}
 	}
 
-	v, _ := gj.subs.LoadOrStore((name + role), &sub{
-		name: name,
-		role: role,
-		add:  make(chan *Member),
-		del:  make(chan *Member),
-		updt: make(chan mmsg, 10),
+	tenant, err := gj.tenantSchema(c)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := gj.subs.LoadOrStore((name + role + tenant), &sub{
+		name:   name,
+		role:   role,
+		tenant: tenant,
+		add:    make(chan *Member),
+		del:    make(chan *Member),
+		updt:   make(chan mmsg, 10),
+		move:   make(chan subMove),
+		done:   make(chan struct{}),
 	})
 	s := v.(*sub)
 
@@ -124,12 +161,19 @@ func (g *GraphJin) Subscribe(
 	})
 
 	if err != nil {
-		gj.subs.Delete((name + role))
+		gj.subs.Delete((name + role + tenant))
+		close(s.done)
 		return nil, err
 	}
 
-	args, err := gj.argList(c, s.qc.st.md, vars, rc)
+	qc := s.getQC()
+
+	args, err := gj.argList(c, qc.st.md, vars, rc)
 	if err != nil {
+		return nil, validationError(err)
+	}
+
+	if err := validateLimitVars(qc.st.qc, qc.st.md, args); err != nil {
 		return nil, err
 	}
 
@@ -145,44 +189,92 @@ func (g *GraphJin) Subscribe(
 		id:     xid.New(),
 		Result: make(chan *Result, 10),
 		sub:    s,
+		qc:     qc,
 		vl:     args.values,
 		params: params,
 		cindx:  args.cindx,
 	}
 
-	m.mm, err = gj.subFirstQuery(s, m, params)
+	m.mm, err = gj.subFirstQuery(s, qc, m, params)
 	if err != nil {
 		return nil, err
 	}
-	s.add <- m
+
+	select {
+	case s.add <- m:
+	case <-s.done:
+		return nil, errors.New("subscription: closed")
+	}
 
 	return m, nil
 }
 
 func (gj *graphjin) newSub(c context.Context, s *sub, query string, vars json.RawMessage) error {
-	var err error
+	s.query = query
+	s.vars = vars
+
+	qc, err := gj.compileSub(c, s)
+	if err != nil {
+		return err
+	}
+	s.setQC(qc)
+
+	go gj.subController(s)
+	return nil
+}
 
+// compileSub compiles the subscription query, queries with
+// parameters are wrapped to run for all members at once
+func (gj *graphjin) compileSub(c context.Context, s *sub) (*queryComp, error) {
 	qr := queryReq{
 		op:    qcode.QTSubscription,
 		name:  s.name,
-		query: []byte(query),
-		vars:  vars,
+		query: []byte(s.query),
+		vars:  s.vars,
 	}
 
-	if s.qc, err = gj.compileQuery(qr, s.role); err != nil {
-		return err
+	qc, err := gj.compileQuery(c, qr, s.role, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(s.qc.st.md.Params()) != 0 {
-		s.qc.st.sql = renderSubWrap(s.qc.st, gj.schema.DBType())
+	if len(qc.st.md.Params()) != 0 {
+		// allow list queries are shared across subscriptions (eg. for other
+		// tenants) so the wrapped query is set on a copy
+		qc = &queryComp{qr: qc.qr, st: qc.st, role: qc.role}
+		qc.st.sql = renderSubWrap(qc.st, gj.schema.DBType())
 	}
+	return qc, nil
+}
 
-	go gj.subController(s)
-	return nil
+// moveSubs hands over the subscriptions to the reloaded instance. Each
+// subscription is recompiled and moved along with its members, if the
+// query no longer compiles or its parameters changed the members are
+// sent the error and closed.
+func (gj *graphjin) moveSubs(gjNew *graphjin) {
+	gj.subs.Range(func(k, v interface{}) bool {
+		s := v.(*sub)
+		mv := subMove{gj: gjNew, ack: make(chan struct{})}
+
+		select {
+		case s.move <- mv:
+			<-mv.ack
+		case <-s.done:
+		}
+		return true
+	})
 }
 
 func (gj *graphjin) subController(s *sub) {
-	defer gj.subs.Delete((s.name + s.role))
+	var moved bool
+
+	defer func() {
+		gj.subs.Delete((s.name + s.role + s.tenant))
+		if !moved {
+			close(s.done)
+		}
+	}()
+
 	var ps time.Duration
 
 	if gj.conf.SubsPollDuration < 5 {
@@ -194,6 +286,11 @@ func (gj *graphjin) subController(s *sub) {
 	for {
 		select {
 		case m := <-s.add:
+			// the params were built for the query before a reload
+			if !sameParams(m.qc, s.qc) {
+				closeResult(s, m.Result, errSubChanged)
+				continue
+			}
 			if err := s.addMember(m); err != nil {
 				gj.log.Printf(errSubs, "add-sub", err)
 				return
@@ -211,12 +308,84 @@ func (gj *graphjin) subController(s *sub) {
 				return
 			}
 
+		case mv := <-s.move:
+			qc, err := mv.gj.compileSub(context.Background(), s)
+			if err != nil {
+				close(mv.ack)
+				s.closeMembers(err)
+				return
+			}
+			// the member params were built for the old query
+			if !sameParams(s.qc, qc) {
+				close(mv.ack)
+				s.closeMembers(errSubChanged)
+				return
+			}
+			s.setQC(qc)
+			mv.gj.subs.Store((s.name + s.role + s.tenant), s)
+			moved = true
+			close(mv.ack)
+
+			go mv.gj.subController(s)
+			return
+
 		case <-time.After(ps):
 			s.fanOutJobs(gj)
 		}
 	}
 }
 
+// closeMembers sends the error to all members and closes
+// their result channels
+func (s *sub) closeMembers(err error) {
+	for _, rc := range s.res {
+		closeResult(s, rc, err)
+	}
+}
+
+// closeResult sends the error to the member and closes its result channel
+func closeResult(s *sub, rc chan *Result, err error) {
+	res := &Result{op: qcode.QTSubscription, name: s.name}
+	res.setError(err) //nolint: errcheck
+
+	select {
+	case rc <- res:
+	case <-time.After(250 * time.Millisecond):
+	}
+	close(rc)
+}
+
+func (s *sub) getQC() *queryComp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.qc
+}
+
+func (s *sub) setQC(qc *queryComp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qc = qc
+}
+
+// sameParams returns true if both queries take the same parameters
+// in the same order so the member params can be used with either
+func sameParams(qc1, qc2 *queryComp) bool {
+	if qc1 == qc2 {
+		return true
+	}
+	p1, p2 := qc1.st.md.Params(), qc2.st.md.Params()
+
+	if len(p1) != len(p2) {
+		return false
+	}
+	for i := range p1 {
+		if p1[i] != p2[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *sub) addMember(m *Member) error {
 	mi := minfo{cindx: m.cindx}
 	if mi.cindx != -1 {
@@ -297,20 +466,20 @@ func (s *sub) fanOutJobs(gj *graphjin) {
 		return
 
 	case len(s.ids) <= maxMembersPerWorker:
-		go gj.subCheckUpdates(s, s.mval, 0)
+		go gj.subCheckUpdates(s, s.qc, s.mval, 0)
 
 	default:
 		// fan out chunks of work to multiple routines
 		// separated by a random duration
 		for i := 0; i < len(s.ids); i += maxMembersPerWorker {
-			go gj.subCheckUpdates(s, s.mval, i)
+			go gj.subCheckUpdates(s, s.qc, s.mval, i)
 		}
 	}
 }
 
-func (gj *graphjin) subCheckUpdates(s *sub, mv mval, start int) {
-	// Do not use the `mval` embedded inside sub since
-	// its not thread safe use the copy `mv mval`.
+func (gj *graphjin) subCheckUpdates(s *sub, qc *queryComp, mv mval, start int) {
+	// Do not use the `mval` and `qc` inside sub since
+	// they are not thread safe use the copies passed in.
 
 	// random wait to prevent multiple queries hitting the db
 	// at the same time.
@@ -321,24 +490,41 @@ func (gj *graphjin) subCheckUpdates(s *sub, mv mval, start int) {
 		end = start + (len(mv.ids) - start)
 	}
 
-	hasParams := len(s.qc.st.md.Params()) != 0
+	hasParams := len(qc.st.md.Params()) != 0
 
 	var rows pgx.Rows
 	var err error
 
-	c := context.Background()
+	c, sp := gj.start(context.Background(), EventSubPoll, Attrs{
+		OpName: s.name,
+		Role:   s.role,
+		SQL:    qc.st.sql,
+		qc:     qc.st.qc,
+	})
+	defer func() { sp.End(Attrs{}, err) }()
+
+	c, cancel := withTimeout(c, gj.statementTimeout(qc.st.role, nil))
+	defer cancel()
+
+	q, release, err := gj.tenantQuerier(c, gj.readPool(), s.tenant)
+	if err != nil {
+		gj.log.Printf(errSubs, "query", err)
+		return
+	}
+	defer release()
 
 	// when params are not available we use a more optimized
 	// codepath that does not use a join query
 	// more details on this optimization are towards the end
 	// of the function
 	if hasParams {
-		rows, err = gj.pool.Query(c, s.qc.st.sql, renderJSONArray(mv.params[start:end]))
+		rows, err = q.Query(c, qc.st.sql, renderJSONArray(mv.params[start:end]))
 	} else {
-		rows, err = gj.pool.Query(c, s.qc.st.sql)
+		rows, err = q.Query(c, qc.st.sql)
 	}
 
 	if err != nil {
+		err = timeoutError(c, err)
 		gj.log.Printf(errSubs, "query", err)
 		return
 	}
@@ -348,7 +534,7 @@ func (gj *graphjin) subCheckUpdates(s *sub, mv mval, start int) {
 
 	i := 0
 	for rows.Next() {
-		if err := rows.Scan(&js); err != nil {
+		if err = rows.Scan(&js); err != nil {
 			gj.log.Printf(errSubs, "scan", err)
 			return
 		}
@@ -356,18 +542,18 @@ func (gj *graphjin) subCheckUpdates(s *sub, mv mval, start int) {
 		i++
 
 		if hasParams {
-			gj.subNotifyMember(s, mv, j, js)
+			gj.subNotifyMember(s, qc, mv, j, js)
 			continue
 		}
 
 		for k := start; k < end; k++ {
-			gj.subNotifyMember(s, mv, k, js)
+			gj.subNotifyMember(s, qc, mv, k, js)
 		}
 		s.js = js
 	}
 }
 
-func (gj *graphjin) subFirstQuery(s *sub, m *Member, params json.RawMessage) (mmsg, error) {
+func (gj *graphjin) subFirstQuery(s *sub, qc *queryComp, m *Member, params json.RawMessage) (mmsg, error) {
 	c := context.Background()
 
 	// when params are not available we use a more optimized
@@ -378,16 +564,26 @@ func (gj *graphjin) subFirstQuery(s *sub, m *Member, params json.RawMessage) (mm
 	var mm mmsg
 	var err error
 
+	var q Querier = gj.readPool()
+
+	if s.js == nil && s.tenant != "" {
+		var release func()
+		if q, release, err = gj.tenantQuerier(c, gj.readPool(), s.tenant); err != nil {
+			return mm, fmt.Errorf(errSubs, "query", err)
+		}
+		defer release()
+	}
+
 	switch {
 	case s.js != nil:
 		js = s.js
 	case params != nil:
-		err = gj.pool.
-			QueryRow(c, s.qc.st.sql, renderJSONArray([]json.RawMessage{params})).
+		err = q.
+			QueryRow(c, qc.st.sql, renderJSONArray([]json.RawMessage{params})).
 			Scan(&js)
 	default:
-		err = gj.pool.
-			QueryRow(c, s.qc.st.sql).
+		err = q.
+			QueryRow(c, qc.st.sql).
 			Scan(&js)
 	}
 
@@ -395,7 +591,7 @@ func (gj *graphjin) subFirstQuery(s *sub, m *Member, params json.RawMessage) (mm
 		return mm, fmt.Errorf(errSubs, "scan", err)
 	}
 
-	mm, err = gj.subNotifyMemberEx(s,
+	mm, err = gj.subNotifyMemberEx(s, qc,
 		[32]byte{},
 		m.cindx,
 		m.id,
@@ -404,8 +600,8 @@ func (gj *graphjin) subFirstQuery(s *sub, m *Member, params json.RawMessage) (mm
 	return mm, err
 }
 
-func (gj *graphjin) subNotifyMember(s *sub, mv mval, j int, js json.RawMessage) {
-	_, err := gj.subNotifyMemberEx(s,
+func (gj *graphjin) subNotifyMember(s *sub, qc *queryComp, mv mval, j int, js json.RawMessage) {
+	_, err := gj.subNotifyMemberEx(s, qc,
 		mv.mi[j].dh,
 		mv.mi[j].cindx,
 		mv.ids[j],
@@ -416,7 +612,7 @@ func (gj *graphjin) subNotifyMember(s *sub, mv mval, j int, js json.RawMessage)
 	}
 }
 
-func (gj *graphjin) subNotifyMemberEx(s *sub,
+func (gj *graphjin) subNotifyMemberEx(s *sub, qc *queryComp,
 	dh [32]byte, cindx int, id xid.ID, rc chan *Result, js json.RawMessage, update bool) (mmsg, error) {
 	mm := mmsg{id: id}
 
@@ -425,7 +621,7 @@ func (gj *graphjin) subNotifyMemberEx(s *sub,
 		return mm, nil
 	}
 
-	cur, err := gj.getCursor(s.qc.st.qc, js)
+	cur, err := gj.getCursor(qc.st.qc, js)
 	if err != nil {
 		return mm, fmt.Errorf(errSubs, "cursor", err)
 	}
@@ -445,8 +641,8 @@ func (gj *graphjin) subNotifyMemberEx(s *sub,
 	res := &Result{
 		op:   qcode.QTQuery,
 		name: s.name,
-		sql:  s.qc.st.sql,
-		role: s.qc.st.role.Name,
+		sql:  qc.st.sql,
+		role: qc.st.role.Name,
 		Data: cur.data,
 	}
 
@@ -524,7 +720,10 @@ func (s *sub) findByID(id xid.ID) (int, bool) {
 
 func (m *Member) Unsubscribe() {
 	if m != nil && !m.done {
-		m.sub.del <- m
+		select {
+		case m.sub.del <- m:
+		case <-m.sub.done:
+		}
 		m.done = true
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"os"
 	"regexp"
 	"testing"
 	"time"
@@ -203,3 +204,105 @@ func TestSubscription(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestSubscriptionReload(t *testing.T) {
+	gql := `subscription test {
+		users(id: $id) {
+			id
+			phone
+		}
+	}`
+
+	vars := json.RawMessage(`{ "id": 4 }`)
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: true, SubsPollDuration: 1})
+	gj, err := core.NewGraphJin(conf, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := gj.Subscribe(context.Background(), gql, vars, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Unsubscribe()
+
+	msg := <-m.Result
+	if exp := `{"users": {"id": 4, "phone": null}}`; string(msg.Data) != exp {
+		t.Fatalf("expected '%s' got '%s'", exp, string(msg.Data))
+	}
+
+	if err := gj.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	q := `UPDATE users SET phone = '650-447-0004' WHERE id = 4`
+	if _, err := pool.Exec(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Exec(context.Background(), `UPDATE users SET phone = NULL WHERE id = 4`) //nolint: errcheck
+
+	// the member is moved to the reloaded instance and keeps getting updates
+	select {
+	case msg = <-m.Result:
+		if exp := `{"users": {"id": 4, "phone": "650-447-0004"}}`; string(msg.Data) != exp {
+			t.Fatalf("expected '%s' got '%s'", exp, string(msg.Data))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("subscription not updated after reload")
+	}
+}
+
+func TestSubscriptionReloadError(t *testing.T) {
+	gql := `subscription getSubUser {
+		users(id: 4) {
+			id
+		}
+	}`
+
+	fn := "./allow-list/queries/getSubUser.yaml"
+	err := os.WriteFile(fn, []byte("name: getSubUser\nquery: "+
+		"subscription getSubUser { users(id: 4) { id } }\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fn)
+
+	conf := newConfig(&core.Config{DBType: dbType, DisableAllowList: false, SubsPollDuration: 1})
+	gj, err := core.NewGraphJin(conf, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := gj.Subscribe(context.Background(), gql, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Unsubscribe()
+
+	msg := <-m.Result
+	if exp := `{"users": {"id": 4}}`; string(msg.Data) != exp {
+		t.Fatalf("expected '%s' got '%s'", exp, string(msg.Data))
+	}
+
+	// the query is no longer in the allow list after the reload
+	if err := os.Remove(fn); err != nil {
+		t.Fatal(err)
+	}
+	if err := gj.ReloadAllowList(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the member is sent the error and its result channel closed
+	select {
+	case msg, ok := <-m.Result:
+		if !ok || len(msg.Errors) == 0 {
+			t.Fatal("expected an error result")
+		}
+		if _, ok := <-m.Result; ok {
+			t.Fatal("expected the result channel to be closed")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("subscription not closed after reload")
+	}
+}
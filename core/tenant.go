@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// initTenants sets up schema-per-tenant multi-tenancy when
+// a list or pattern of tenant schemas is configured
+func (gj *graphjin) initTenants() error {
+	c := gj.conf
+
+	if len(c.Tenants) == 0 && c.TenantPattern == "" {
+		return nil
+	}
+
+	gj.tenants = make(map[string]struct{}, len(c.Tenants))
+
+	for _, t := range c.Tenants {
+		gj.tenants[t] = struct{}{}
+	}
+
+	if c.TenantPattern != "" {
+		re, err := regexp.Compile("^(?:" + c.TenantPattern + ")$")
+		if err != nil {
+			return fmt.Errorf("tenant_pattern: %w", err)
+		}
+		gj.tenantRe = re
+	}
+
+	return nil
+}
+
+// tenantSchema returns the tenant schema set on the context after validating
+// it, if none is set the default schema is returned. Returns an empty string
+// if multi-tenancy is not enabled
+func (gj *graphjin) tenantSchema(c context.Context) (string, error) {
+	if gj.tenants == nil {
+		return "", nil
+	}
+
+	v, ok := c.Value(TenantKey).(string)
+	if !ok || v == "" {
+		return gj.dbinfo.Schema, nil
+	}
+
+	if _, ok := gj.tenants[v]; ok {
+		return v, nil
+	}
+
+	if gj.tenantRe != nil && gj.tenantRe.MatchString(v) {
+		return v, nil
+	}
+
+	return "", &kindError{kind: ErrForbidden, err: fmt.Errorf("tenant not allowed: %s", v)}
+}
+
+// setSearchPath sets the search path of the connection to the tenant schema.
+// The search path is set on every request so pooled connections never
+// keep the schema of an earlier tenant
+func (gj *graphjin) setSearchPath(c context.Context, conn Querier) error {
+	schema, err := gj.tenantSchema(c)
+	if err != nil || schema == "" {
+		return err
+	}
+
+	// within a transaction the search path is only set till the
+	// transaction ends
+	_, local := conn.(pgx.Tx)
+
+	_, err = conn.Exec(c, `SELECT set_config('search_path', $1, $2)`,
+		pgx.Identifier{schema}.Sanitize(), local)
+	return err
+}
+
+// tenantQuerier returns a connection from the pool with the search path set
+// to the tenant schema or the pool itself if multi-tenancy is not enabled
+func (gj *graphjin) tenantQuerier(c context.Context, pool *pgxpool.Pool, tenant string) (
+	Querier, func(), error) {
+
+	if tenant == "" {
+		return pool, func() {}, nil
+	}
+
+	conn, err := pool.Acquire(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = conn.Exec(c, `SELECT set_config('search_path', $1, false)`,
+		pgx.Identifier{tenant}.Sanitize())
+	if err != nil {
+		conn.Release()
+		return nil, nil, err
+	}
+
+	return conn, conn.Release, nil
+}
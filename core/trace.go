@@ -0,0 +1,141 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+)
+
+type extensions struct {
+	Tracing *trace `json:"tracing,omitempty"`
+}
+
+// trace is the Apollo tracing extension, all methods are no-ops
+// when the trace is nil (tracing disabled)
+type trace struct {
+	Version    int           `json:"version"`
+	StartTime  time.Time     `json:"startTime"`
+	EndTime    time.Time     `json:"endTime"`
+	Duration   time.Duration `json:"duration"`
+	Parsing    offset        `json:"parsing"`
+	Validation offset        `json:"validation"`
+	Execution  execution     `json:"execution"`
+	mu         sync.Mutex
+}
+
+type offset struct {
+	StartOffset time.Duration `json:"startOffset"`
+	Duration    time.Duration `json:"duration"`
+}
+
+type execution struct {
+	Resolvers []resolver `json:"resolvers"`
+}
+
+type resolver struct {
+	Path        []string      `json:"path"`
+	ParentType  string        `json:"parentType"`
+	FieldName   string        `json:"fieldName"`
+	ReturnType  string        `json:"returnType"`
+	StartOffset time.Duration `json:"startOffset"`
+	Duration    time.Duration `json:"duration"`
+}
+
+func newTrace() *trace {
+	return &trace{
+		Version:   1,
+		StartTime: time.Now(),
+		Execution: execution{Resolvers: []resolver{}},
+	}
+}
+
+// now returns the current time if tracing is enabled
+func (t *trace) now() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (t *trace) offset(st time.Time) offset {
+	return offset{StartOffset: st.Sub(t.StartTime), Duration: time.Since(st)}
+}
+
+// addParsing records the time taken to parse the query
+func (t *trace) addParsing(st time.Time) {
+	if t != nil {
+		t.Parsing = t.offset(st)
+	}
+}
+
+// addValidation records the time taken to validate and
+// compile the query into sql
+func (t *trace) addValidation(st time.Time) {
+	if t != nil {
+		t.Validation = t.offset(st)
+	}
+}
+
+// addResolver records the time taken to resolve a select
+func (t *trace) addResolver(sel []qcode.Select, id int32, parentType string, st time.Time) {
+	if t == nil {
+		return
+	}
+	o := t.offset(st)
+
+	r := resolver{
+		Path:        selectPath(sel, id),
+		ParentType:  parentType,
+		FieldName:   sel[id].FieldName,
+		ReturnType:  sel[id].Table,
+		StartOffset: o.StartOffset,
+		Duration:    o.Duration,
+	}
+
+	t.mu.Lock()
+	t.Execution.Resolvers = append(t.Execution.Resolvers, r)
+	t.mu.Unlock()
+}
+
+// selectPath returns the field names from the root select
+// down to the select
+func selectPath(sel []qcode.Select, id int32) []string {
+	n := 1
+	for i := sel[id].ParentID; i != -1; i = sel[i].ParentID {
+		n++
+	}
+	path := make([]string, n)
+
+	for i := id; i != -1; i = sel[i].ParentID {
+		n--
+		path[n] = sel[i].FieldName
+	}
+	return path
+}
+
+// addQuery records the time taken by the database query against
+// each of the root selects
+func (t *trace) addQuery(qc *qcode.QCode, st time.Time) {
+	if t == nil {
+		return
+	}
+
+	parentType := "Query"
+	if qc.Type == qcode.QTMutation {
+		parentType = "Mutation"
+	}
+
+	for _, id := range qc.Roots {
+		t.addResolver(qc.Selects, id, parentType, st)
+	}
+}
+
+func (t *trace) finish() *extensions {
+	if t == nil {
+		return nil
+	}
+	t.EndTime = time.Now()
+	t.Duration = t.EndTime.Sub(t.StartTime)
+	return &extensions{Tracing: t}
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dosco/graphjin/core/internal/qcode"
+	"github.com/goccy/go-json"
+)
+
+// ReloadAllowList reloads the queries and fragments from the allow list without
+// re-running database discovery. All queries are compiled for every role before the
+// new allow list is used, on an error the current allow list is kept and the error
+// returned. A query only has to compile for one of the roles, since roles can block
+// tables or columns used by it.
+// Active subscriptions are moved over the same way as with Reload.
+func (g *GraphJin) ReloadAllowList() error {
+	gj := g.Load().(*graphjin)
+
+	if gj.allowList == nil {
+		return errors.New("allow list: not enabled")
+	}
+
+	gjNew := gj.cloneConfig()
+
+	if err := gjNew.initAPQCache(); err != nil {
+		return err
+	}
+
+	queries, err := gjNew.loadAllowList()
+	if err != nil {
+		return err
+	}
+
+	if err := gjNew.compileAllowList(queries); err != nil {
+		return err
+	}
+	gjNew.queries = queries
+
+	gj.moveSubs(gjNew)
+	g.Store(gjNew)
+	return nil
+}
+
+// WatchAllowList polls the allow list queries and fragments directories for
+// changes and calls ReloadAllowList when a file is added, removed or modified.
+// Errors are passed to onErr or logged if it is nil. Blocks till the context
+// is cancelled.
+//
+// Example usage:
+/*
+	go gj.WatchAllowList(ctx, 2*time.Second, nil)
+*/
+func (g *GraphJin) WatchAllowList(c context.Context, every time.Duration, onErr func(error)) error {
+	gj := g.Load().(*graphjin)
+
+	if gj.allowList == nil {
+		return errors.New("allow list: not enabled")
+	}
+
+	if onErr == nil {
+		onErr = func(err error) {
+			gj.log.Printf("allow list: reload failed: %s", err)
+		}
+	}
+
+	fp, err := gj.allowList.Fingerprint()
+	if err != nil {
+		return err
+	}
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return nil
+		case <-t.C:
+		}
+
+		gj := g.Load().(*graphjin)
+
+		fp1, err := gj.allowList.Fingerprint()
+		if err != nil {
+			onErr(err)
+			continue
+		}
+
+		if fp1 == fp {
+			continue
+		}
+		fp = fp1
+
+		if err := g.ReloadAllowList(); err != nil {
+			onErr(err)
+		}
+	}
+}
+
+// compileAllowList compiles the allow list queries for their role, the queries
+// that fail for a role are left to be compiled when used. Mutations without saved
+// variables can't be compiled and are only parsed. Returns an error if a query
+// does not compile for any of the roles
+func (gj *graphjin) compileAllowList(queries map[string]*queryComp) error {
+	errs := make(map[string]error)
+	done := make(map[string]bool)
+
+	for _, qc := range queries {
+		name := qc.qr.name
+
+		if qc.qr.op == qcode.QTMutation && len(qc.qr.vars) == 0 {
+			if _, err := gj.qc.Parse(qc.qr.query); err != nil {
+				return fmt.Errorf("allow list: %s: %w", name, err)
+			}
+			continue
+		}
+
+		vm := make(map[string]json.RawMessage)
+
+		if len(qc.qr.vars) != 0 {
+			if err := json.Unmarshal(qc.qr.vars, &vm); err != nil {
+				return fmt.Errorf("allow list: %s: variables: %w", name, err)
+			}
+		}
+
+		st, err := gj.compileQueryRole(context.Background(), qc.qr, vm, qc.role, nil)
+		if err != nil {
+			if _, ok := errs[name]; !ok {
+				errs[name] = err
+			}
+			continue
+		}
+		qc.st = st
+		done[name] = true
+	}
+
+	for name, err := range errs {
+		if !done[name] {
+			return fmt.Errorf("allow list: %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// cloneConfig returns a new instance that shares the database schema,
+// roles, compilers, result and resolver caches but not the allow list queries,
+// APQ cache or subscriptions
+func (gj *graphjin) cloneConfig() *graphjin {
+	return &graphjin{
+		conf:        gj.conf,
+		pool:        gj.pool,
+		log:         gj.log,
+		dbtype:      gj.dbtype,
+		dbinfo:      gj.dbinfo,
+		schema:      gj.schema,
+		allowList:   gj.allowList,
+		roles:       gj.roles,
+		roleStmt:    gj.roleStmt,
+		roleStmtMD:  gj.roleStmtMD,
+		rmap:        gj.rmap,
+		abacEnabled: gj.abacEnabled,
+		qc:          gj.qc,
+		pc:          gj.pc,
+		obs:         gj.obs,
+		opts:        gj.opts,
+		replicas:    gj.replicas,
+		tenants:     gj.tenants,
+		tenantRe:    gj.tenantRe,
+		rcache:      gj.rcache,
+		rescache:    gj.rescache,
+	}
+}
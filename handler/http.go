@@ -0,0 +1,382 @@
+// Package handler provides net/http handlers to serve GraphJin over HTTP
+// (GraphQL-over-HTTP), WebSockets (graphql-transport-ws) and Server-Sent Events.
+//
+// Example usage:
+/*
+	gj, err := core.NewGraphJin(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h := handler.New(gj, &handler.Config{
+		UserID: func(r *http.Request) (interface{}, error) {
+			return r.Header.Get("X-User-ID"), nil
+		},
+	})
+
+	http.Handle("/api/v1/graphql", h)
+*/
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMaxBodySize = 10 << 20
+
+	mimeJSON            = "application/json"
+	mimeGraphQLJSON     = "application/graphql+json"
+	mimeGraphQLResponse = "application/graphql-response+json"
+)
+
+// Config contains the settings for the handlers
+type Config struct {
+	// UserID extracts the user id from the request. This value is set
+	// as core.UserIDKey on the context. Returning a nil value means
+	// the request is from an anonymous user
+	UserID func(r *http.Request) (interface{}, error)
+
+	// UserRole extracts the user role from the request. This value is set
+	// as core.UserRoleKey on the context. Returning an empty string means
+	// the role is decided by GraphJin
+	UserRole func(r *http.Request) (string, error)
+
+	// MaxBodySize is the max allowed size of the request body in bytes.
+	// Default set to 10MB
+	MaxBodySize int64
+
+	// WSInit extracts the user id and role from the payload of the websocket
+	// connection_init message. When set the values returned override the ones
+	// extracted from the upgrade request. Returning an error closes the
+	// connection as forbidden
+	WSInit func(payload json.RawMessage) (userID interface{}, role string, err error)
+
+	// WSInitTimeout is how long to wait for the connection_init message
+	// after a websocket is opened. Default set to 3 seconds
+	WSInitTimeout time.Duration
+
+	// WSCheckOrigin returns true if the origin of a websocket upgrade request
+	// is allowed. Default only allows requests from the same host
+	WSCheckOrigin func(r *http.Request) bool
+
+	// SSEKeepAlive is how often a keep-alive comment is sent on an idle
+	// server-sent events stream. Default set to 15 seconds
+	SSEKeepAlive time.Duration
+}
+
+// Handler serves GraphQL queries and mutations over HTTP using
+// GET query strings or POST JSON requests. Websocket upgrade requests
+// are served using the graphql-transport-ws protocol and requests that
+// accept 'text/event-stream' are served as Server-Sent Events
+type Handler struct {
+	gj   *core.GraphJin
+	conf Config
+}
+
+type gqlReq struct {
+	Query  string          `json:"query"`
+	OpName string          `json:"operationName"`
+	Vars   json.RawMessage `json:"variables"`
+	Ext    extensions      `json:"extensions"`
+}
+
+type extensions struct {
+	PersistedQuery *persistedQuery `json:"persistedQuery"`
+}
+
+type persistedQuery struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+// reqError is an error with the http status code to return
+type reqError struct {
+	status int
+	err    error
+}
+
+func (e *reqError) Error() string {
+	return e.err.Error()
+}
+
+func newReqError(status int, format string, a ...interface{}) error {
+	return &reqError{status: status, err: fmt.Errorf(format, a...)}
+}
+
+// New creates a http handler for the GraphJin instance
+func New(gj *core.GraphJin, conf *Config) *Handler {
+	h := &Handler{gj: gj}
+
+	if conf != nil {
+		h.conf = *conf
+	}
+
+	if h.conf.MaxBodySize == 0 {
+		h.conf.MaxBodySize = defaultMaxBodySize
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.ServeWebSocket(w, r)
+		return
+	}
+
+	if isSSE(r) {
+		h.ServeSSE(w, r)
+		return
+	}
+
+	req, err := h.parseRequest(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	op := h.operation(req)
+
+	switch {
+	case op == core.OpSubscription:
+		writeError(w, r, newReqError(http.StatusBadRequest,
+			"subscriptions are only supported over websockets or server-sent events"))
+		return
+
+	case op == core.OpMutation && r.Method == http.MethodGet:
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, newReqError(http.StatusMethodNotAllowed,
+			"mutations are only supported with POST requests"))
+		return
+	}
+
+	ctx, err := h.authContext(r)
+	if err != nil {
+		writeError(w, r, newReqError(http.StatusUnauthorized, "%s", err))
+		return
+	}
+
+	rc := &core.ReqConfig{Header: r.Header}
+
+	if pq := req.Ext.PersistedQuery; pq != nil && pq.Sha256Hash != "" {
+		rc.APQKey = pq.Sha256Hash
+	}
+
+	res, err := h.gj.GraphQL(ctx, req.Query, req.Vars, rc)
+
+	if cc := res.CacheControl(); cc != "" && len(res.Errors) == 0 {
+		w.Header().Set("Cache-Control", cc)
+	}
+
+	status := http.StatusOK
+	ct := responseType(r)
+
+	// With the newer response media type requests that fail without
+	// any data get a 4xx or 5xx status, the older one always gets a 200
+	if ct == mimeGraphQLResponse && err != nil && len(res.Data) == 0 {
+		status = errorStatus(err)
+	}
+
+	writeJSON(w, ct, status, res)
+}
+
+// parseRequest parses the GraphQL request from the query string of
+// a GET request or the JSON body of a POST request
+func (h *Handler) parseRequest(w http.ResponseWriter, r *http.Request) (gqlReq, error) {
+	var req gqlReq
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OpName = q.Get("operationName")
+
+		if v := q.Get("variables"); v != "" {
+			if !json.Valid([]byte(v)) {
+				return req, newReqError(http.StatusBadRequest, "variables: invalid json")
+			}
+			req.Vars = json.RawMessage(v)
+		}
+
+		if v := q.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Ext); err != nil {
+				return req, newReqError(http.StatusBadRequest, "extensions: %s", err)
+			}
+		}
+
+	case http.MethodPost:
+		ct := strings.ToLower(r.Header.Get("Content-Type"))
+		if i := strings.IndexByte(ct, ';'); i != -1 {
+			ct = ct[:i]
+		}
+		ct = strings.TrimSpace(ct)
+
+		if ct != mimeJSON && ct != mimeGraphQLJSON {
+			return req, newReqError(http.StatusUnsupportedMediaType,
+				"unsupported content-type: %s", ct)
+		}
+
+		b, err := ioutil.ReadAll(io.LimitReader(r.Body, h.conf.MaxBodySize+1))
+		if err != nil {
+			return req, newReqError(http.StatusBadRequest, "request body: %s", err)
+		}
+
+		if int64(len(b)) > h.conf.MaxBodySize {
+			return req, newReqError(http.StatusRequestEntityTooLarge,
+				"request body: larger than %d bytes", h.conf.MaxBodySize)
+		}
+
+		if err := json.Unmarshal(b, &req); err != nil {
+			return req, newReqError(http.StatusBadRequest, "request body: %s", err)
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return req, newReqError(http.StatusMethodNotAllowed,
+			"method not allowed: %s", r.Method)
+	}
+
+	pq := req.Ext.PersistedQuery
+
+	if req.Query == "" && (pq == nil || pq.Sha256Hash == "") {
+		return req, newReqError(http.StatusBadRequest, "query is required")
+	}
+
+	if req.Query != "" && pq != nil && pq.Sha256Hash != "" {
+		h := sha256.Sum256([]byte(req.Query))
+		if !strings.EqualFold(hex.EncodeToString(h[:]), pq.Sha256Hash) {
+			return req, newReqError(http.StatusBadRequest,
+				"persisted query: sha256 hash does not match query")
+		}
+	}
+
+	if err := checkOpName(req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// operation returns the operation type of the request, for requests that
+// only send a persisted query key it's the type of the persisted query
+func (h *Handler) operation(req gqlReq) core.OpType {
+	if pq := req.Ext.PersistedQuery; req.Query == "" && pq != nil {
+		op, _, _ := h.gj.PersistedOperation(pq.Sha256Hash)
+		return op
+	}
+	op, _ := core.Operation(req.Query)
+	return op
+}
+
+// checkOpName returns an error if the operation name is set and does
+// not match the operation in the query, only a single operation is
+// supported per query
+func checkOpName(req gqlReq) error {
+	if req.OpName == "" || req.Query == "" {
+		return nil
+	}
+
+	if _, name := core.Operation(req.Query); name != req.OpName {
+		return newReqError(http.StatusBadRequest,
+			"operation not found: %s", req.OpName)
+	}
+	return nil
+}
+
+// authContext returns the request context with the user id and role
+// set using the extractors from the config
+func (h *Handler) authContext(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+
+	if h.conf.UserID != nil {
+		v, err := h.conf.UserID(r)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			ctx = context.WithValue(ctx, core.UserIDKey, v)
+		}
+	}
+
+	if h.conf.UserRole != nil {
+		v, err := h.conf.UserRole(r)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			ctx = context.WithValue(ctx, core.UserRoleKey, v)
+		}
+	}
+
+	return ctx, nil
+}
+
+// responseType picks the response media type based on the accept header
+func responseType(r *http.Request) string {
+	if strings.Contains(r.Header.Get("Accept"), mimeGraphQLResponse) {
+		return mimeGraphQLResponse
+	}
+	return mimeJSON
+}
+
+// errorStatus returns the http status code for an error
+// returned by GraphJin
+func errorStatus(err error) int {
+	var re *reqError
+
+	switch {
+	case errors.As(err, &re):
+		return re.status
+	case errors.Is(err, core.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, core.ErrConstraintViolation):
+		return http.StatusConflict
+	case errors.Is(err, core.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, core.ErrValidation),
+		errors.Is(err, core.ErrNotInAllowList),
+		errors.Is(err, core.ErrPersistedQueryNotFound):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// toError returns the GraphQL error for an error
+func toError(err error) core.Error {
+	var ge *core.Error
+	if errors.As(err, &ge) {
+		return *ge
+	}
+	return core.Error{Message: err.Error()}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	res := core.Result{Errors: []core.Error{toError(err)}}
+	writeJSON(w, responseType(r), errorStatus(err), &res)
+}
+
+func writeJSON(w http.ResponseWriter, ct string, status int, res *core.Result) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ct+"; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b) //nolint: errcheck
+}
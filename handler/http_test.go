@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequestPost(t *testing.T) {
+	h := New(nil, nil)
+
+	body := `{
+		"query": "query getProducts { products { id } }",
+		"operationName": "getProducts",
+		"variables": { "limit": 10 }
+	}`
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	req, err := h.parseRequest(httptest.NewRecorder(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, "query getProducts { products { id } }", req.Query)
+	assert.Equal(t, "getProducts", req.OpName)
+	assert.JSONEq(t, `{ "limit": 10 }`, string(req.Vars))
+}
+
+func TestParseRequestGet(t *testing.T) {
+	h := New(nil, nil)
+
+	q := url.Values{}
+	q.Set("query", "{ products { id } }")
+	q.Set("variables", `{"id":1}`)
+	q.Set("extensions", `{"persistedQuery":{"version":1,"sha256Hash":"abc"}}`)
+
+	r := httptest.NewRequest("GET", "/?"+q.Encode(), nil)
+
+	_, err := h.parseRequest(httptest.NewRecorder(), r)
+	assert.EqualError(t, err, "persisted query: sha256 hash does not match query")
+
+	sum := sha256.Sum256([]byte("{ products { id } }"))
+	hash := hex.EncodeToString(sum[:])
+	q.Set("extensions", `{"persistedQuery":{"version":1,"sha256Hash":"`+hash+`"}}`)
+
+	r = httptest.NewRequest("GET", "/?"+q.Encode(), nil)
+
+	req, err := h.parseRequest(httptest.NewRecorder(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, "{ products { id } }", req.Query)
+	assert.JSONEq(t, `{"id":1}`, string(req.Vars))
+	assert.Equal(t, hash, req.Ext.PersistedQuery.Sha256Hash)
+}
+
+func TestParseRequestAPQOnly(t *testing.T) {
+	h := New(nil, nil)
+
+	body := `{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"abc"}}}`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	req, err := h.parseRequest(httptest.NewRecorder(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, "", req.Query)
+	assert.Equal(t, "abc", req.Ext.PersistedQuery.Sha256Hash)
+}
+
+func TestRequestErrors(t *testing.T) {
+	h := New(nil, &Config{MaxBodySize: 100})
+
+	tests := []struct {
+		name   string
+		method string
+		ct     string
+		target string
+		body   string
+		status int
+	}{
+		{"method", "PUT", "application/json", "/", `{"query":"{ products { id } }"}`, 405},
+		{"content_type", "POST", "text/plain", "/", `{"query":"{ products { id } }"}`, 415},
+		{"bad_json", "POST", "application/json", "/", `{"query":`, 400},
+		{"no_query", "POST", "application/json", "/", `{"variables":{}}`, 400},
+		{"too_large", "POST", "application/json", "/", `{"query":"` + strings.Repeat("a", 200) + `"}`, 413},
+		{"get_mutation", "GET", "", "/?query=" + url.QueryEscape("mutation { products { id } }"), "", 405},
+		{"get_bad_vars", "GET", "", "/?query=" + url.QueryEscape("{ products { id } }") + "&variables=%7B", "", 400},
+		{"subscription", "POST", "application/json", "/", `{"query":"subscription { products { id } }"}`, 400},
+		{"op_name", "POST", "application/json", "/", `{"query":"query getProducts { products { id } }","operationName":"getUsers"}`, 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.ct != "" {
+				r.Header.Set("Content-Type", tt.ct)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), `"errors":[{"message":`)
+		})
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestRequestBodyReadError(t *testing.T) {
+	h := New(nil, nil)
+
+	r := httptest.NewRequest("POST", "/", errReader{})
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "connection reset")
+}
+
+func TestRequestErrorResponseType(t *testing.T) {
+	h := New(nil, nil)
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"variables":{}}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/graphql-response+json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/graphql-response+json; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{core.ErrForbidden, http.StatusForbidden},
+		{core.ErrConstraintViolation, http.StatusConflict},
+		{core.ErrTimeout, http.StatusGatewayTimeout},
+		{core.ErrValidation, http.StatusBadRequest},
+		{core.ErrNotInAllowList, http.StatusBadRequest},
+		{core.ErrPersistedQueryNotFound, http.StatusBadRequest},
+		{fmt.Errorf("graphql: %w", core.ErrForbidden), http.StatusForbidden},
+		{newReqError(http.StatusUnauthorized, "unauthorized"), http.StatusUnauthorized},
+		{errors.New("database down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.status, errorStatus(tt.err), tt.err.Error())
+	}
+}
+
+func TestAuthContext(t *testing.T) {
+	h := New(nil, &Config{
+		UserID: func(r *http.Request) (interface{}, error) {
+			if v := r.Header.Get("X-User-ID"); v != "" {
+				return v, nil
+			}
+			return nil, nil
+		},
+		UserRole: func(r *http.Request) (string, error) {
+			if r.Header.Get("X-Role") == "bad" {
+				return "", errors.New("invalid role")
+			}
+			return r.Header.Get("X-Role"), nil
+		},
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx, err := h.authContext(r)
+	assert.NoError(t, err)
+	assert.Nil(t, ctx.Value(core.UserIDKey))
+	assert.Nil(t, ctx.Value(core.UserRoleKey))
+
+	r.Header.Set("X-User-ID", "5")
+	r.Header.Set("X-Role", "admin")
+	ctx, err = h.authContext(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "5", ctx.Value(core.UserIDKey))
+	assert.Equal(t, "admin", ctx.Value(core.UserRoleKey))
+
+	r.Header.Set("X-Role", "bad")
+	_, err = h.authContext(r)
+	assert.EqualError(t, err, "invalid role")
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/goccy/go-json"
+)
+
+const (
+	mimeEventStream = "text/event-stream"
+
+	defaultSSEKeepAlive = 15 * time.Second
+)
+
+// ServeSSE serves queries, mutations and subscriptions as a stream of
+// Server-Sent Events. Every result is sent as a 'next' event, a 'complete'
+// event is sent once a query or mutation is done. Subscriptions stream
+// until the client disconnects.
+func (h *Handler) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, newReqError(http.StatusInternalServerError,
+			"server-sent events: streaming not supported"))
+		return
+	}
+
+	req, err := h.parseRequest(w, r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	ctx, err := h.authContext(r)
+	if err != nil {
+		writeError(w, r, newReqError(http.StatusUnauthorized, "%s", err))
+		return
+	}
+
+	rc := &core.ReqConfig{Header: r.Header}
+
+	if pq := req.Ext.PersistedQuery; pq != nil && pq.Sha256Hash != "" {
+		rc.APQKey = pq.Sha256Hash
+	}
+
+	op := h.operation(req)
+
+	if op == core.OpMutation && r.Method == http.MethodGet {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, newReqError(http.StatusMethodNotAllowed,
+			"mutations are only supported with POST requests"))
+		return
+	}
+
+	if op != core.OpSubscription {
+		res, _ := h.gj.GraphQL(ctx, req.Query, req.Vars, rc)
+
+		setSSEHeaders(w)
+		writeEvent(w, "next", res)     //nolint: errcheck
+		writeEvent(w, "complete", nil) //nolint: errcheck
+		fl.Flush()
+		return
+	}
+
+	m, err := h.gj.Subscribe(ctx, req.Query, req.Vars, rc)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer m.Unsubscribe()
+
+	setSSEHeaders(w)
+	fl.Flush()
+
+	h.stream(ctx, w, fl, m.Result)
+}
+
+// stream writes every result as an event and keep-alive comments when idle
+// till the context is cancelled
+func (h *Handler) stream(ctx context.Context, w io.Writer, fl http.Flusher, results <-chan *core.Result) {
+	ka := h.conf.SSEKeepAlive
+	if ka == 0 {
+		ka = defaultSSEKeepAlive
+	}
+
+	t := time.NewTicker(ka)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case res, ok := <-results:
+			// closed when the subscription is stopped (eg. on reload)
+			if !ok {
+				writeEvent(w, "complete", nil) //nolint: errcheck
+				fl.Flush()
+				return
+			}
+			if err := writeEvent(w, "next", res); err != nil {
+				return
+			}
+			fl.Flush()
+
+		case <-t.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			fl.Flush()
+		}
+	}
+}
+
+// isSSE returns true if the client only accepts an event stream
+func isSSE(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, mimeEventStream) &&
+		!strings.Contains(accept, mimeJSON) &&
+		!strings.Contains(accept, mimeGraphQLResponse)
+}
+
+func setSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", mimeEventStream+"; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeEvent(w io.Writer, event string, res *core.Result) error {
+	var data []byte
+
+	if res != nil {
+		var err error
+		if data, err = json.Marshal(res); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, "event: "+event+"\ndata: "+string(data)+"\n\n")
+	return err
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSEStream(t *testing.T) {
+	h := New(nil, &Config{SSEKeepAlive: 20 * time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := make(chan *core.Result, 2)
+	w := httptest.NewRecorder()
+
+	results <- &core.Result{Data: []byte(`{"products":[{"id":1}]}`)}
+	results <- &core.Result{Data: []byte(`{"products":[{"id":2}]}`)}
+
+	done := make(chan struct{})
+	go func() {
+		h.stream(ctx, w, w, results)
+		close(done)
+	}()
+
+	time.Sleep(70 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body,
+		"event: next\ndata: {\"data\":{\"products\":[{\"id\":1}]}}\n\n"+
+			"event: next\ndata: {\"data\":{\"products\":[{\"id\":2}]}}\n\n"))
+	assert.Contains(t, body, ": keep-alive\n\n")
+}
+
+func TestSSEStreamClosed(t *testing.T) {
+	h := New(nil, &Config{})
+
+	results := make(chan *core.Result, 1)
+	w := httptest.NewRecorder()
+
+	results <- &core.Result{Errors: []core.Error{{Message: "subscription closed"}}}
+	close(results)
+
+	h.stream(context.Background(), w, w, results)
+
+	assert.Equal(t,
+		"event: next\ndata: {\"errors\":[{\"message\":\"subscription closed\"}]}\n\n"+
+			"event: complete\ndata: \n\n", w.Body.String())
+}
+
+func TestIsSSE(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.False(t, isSSE(r))
+
+	r.Header.Set("Accept", "text/event-stream")
+	assert.True(t, isSSE(r))
+
+	r.Header.Set("Accept", "application/json, text/event-stream")
+	assert.False(t, isSSE(r))
+}
+
+func TestSSERequestErrors(t *testing.T) {
+	h := New(nil, nil)
+
+	r := httptest.NewRequest("DELETE", "/", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	assert.Equal(t, 405, w.Code)
+	assert.Contains(t, w.Body.String(), `"errors":[{"message":`)
+}
@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dosco/graphjin/core"
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+)
+
+// The graphql-transport-ws protocol
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const (
+	wsProtocol = "graphql-transport-ws"
+
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+
+	defaultWSInitTimeout = 3 * time.Second
+)
+
+// Websocket close codes used by the protocol
+const (
+	closeBadRequest       = 4400
+	closeUnauthorized     = 4401
+	closeForbidden        = 4403
+	closeSubprotocol      = 4406
+	closeInitTimeout      = 4408
+	closeSubscriberExists = 4409
+	closeTooManyInits     = 4429
+)
+
+type wsMsg struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type wsConn struct {
+	h    *Handler
+	conn *websocket.Conn
+	ctx  context.Context
+
+	// headers of the upgrade request
+	header http.Header
+
+	// guards writes to the websocket
+	wmu sync.Mutex
+
+	// guards the fields below
+	mu     sync.Mutex
+	inited bool
+	acked  bool
+	subs   map[string]*wsOp
+}
+
+// wsOp is a running operation, the client can reuse the id once the
+// operation completes so it's used to only remove its own entry
+type wsOp struct {
+	cancel context.CancelFunc
+}
+
+var upgrader = websocket.Upgrader{
+	Subprotocols: []string{wsProtocol},
+}
+
+// ServeWebSocket serves queries, mutations and subscriptions over a websocket
+// using the graphql-transport-ws protocol. Subscriptions stream every new
+// result as a 'next' message until the client sends a 'complete' message
+func (h *Handler) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	ctx, err := h.authContext(r)
+	if err != nil {
+		writeError(w, r, newReqError(http.StatusUnauthorized, "%s", err))
+		return
+	}
+
+	// a nil check origin only allows the same host
+	up := upgrader
+	up.CheckOrigin = h.conf.WSCheckOrigin
+
+	conn, err := up.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already replied with an error
+		return
+	}
+	conn.SetReadLimit(h.conf.MaxBodySize)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := &wsConn{
+		h:      h,
+		conn:   conn,
+		ctx:    ctx,
+		header: r.Header,
+		subs:   make(map[string]*wsOp),
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != wsProtocol {
+		c.close(closeSubprotocol, "Subprotocol not acceptable")
+		return
+	}
+
+	initTimeout := h.conf.WSInitTimeout
+	if initTimeout == 0 {
+		initTimeout = defaultWSInitTimeout
+	}
+
+	t := time.AfterFunc(initTimeout, func() {
+		c.mu.Lock()
+		acked := c.acked
+		c.mu.Unlock()
+
+		if !acked {
+			c.close(closeInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer t.Stop()
+
+	c.readLoop()
+}
+
+func (c *wsConn) readLoop() {
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg wsMsg
+		if err := json.Unmarshal(b, &msg); err != nil {
+			c.close(closeBadRequest, "Invalid message received")
+			return
+		}
+
+		if err := c.handleMsg(msg); err != nil {
+			return
+		}
+	}
+}
+
+func (c *wsConn) handleMsg(msg wsMsg) error {
+	switch msg.Type {
+	case msgConnectionInit:
+		c.mu.Lock()
+		inited := c.inited
+		c.inited = true
+		c.mu.Unlock()
+
+		if inited {
+			return c.close(closeTooManyInits, "Too many initialisation requests")
+		}
+
+		if err := c.setInitPayload(msg.Payload); err != nil {
+			return c.close(closeForbidden, "Forbidden")
+		}
+
+		c.mu.Lock()
+		c.acked = true
+		c.mu.Unlock()
+
+		return c.write(wsMsg{Type: msgConnectionAck})
+
+	case msgPing:
+		return c.write(wsMsg{Type: msgPong, Payload: msg.Payload})
+
+	case msgPong:
+		return nil
+
+	case msgSubscribe:
+		return c.subscribe(msg)
+
+	case msgComplete:
+		c.mu.Lock()
+		op, ok := c.subs[msg.ID]
+		delete(c.subs, msg.ID)
+		c.mu.Unlock()
+
+		if ok {
+			op.cancel()
+		}
+		return nil
+	}
+
+	return c.close(closeBadRequest, "Invalid message received")
+}
+
+// setInitPayload maps the connection_init payload to the
+// user id and role values on the context
+func (c *wsConn) setInitPayload(payload json.RawMessage) error {
+	fn := c.h.conf.WSInit
+	if fn == nil {
+		return nil
+	}
+
+	userID, role, err := fn(payload)
+	if err != nil {
+		return err
+	}
+
+	if userID != nil {
+		c.ctx = context.WithValue(c.ctx, core.UserIDKey, userID)
+	}
+	if role != "" {
+		c.ctx = context.WithValue(c.ctx, core.UserRoleKey, role)
+	}
+	return nil
+}
+
+func (c *wsConn) subscribe(msg wsMsg) error {
+	var req gqlReq
+
+	c.mu.Lock()
+	acked := c.acked
+	_, exists := c.subs[msg.ID]
+	c.mu.Unlock()
+
+	if !acked {
+		return c.close(closeUnauthorized, "Unauthorized")
+	}
+
+	if msg.ID == "" {
+		return c.close(closeBadRequest, "Subscribe message requires an id")
+	}
+
+	if exists {
+		return c.close(closeSubscriberExists,
+			fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+	}
+
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return c.close(closeBadRequest, "Invalid subscribe payload")
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	op := &wsOp{cancel: cancel}
+
+	c.mu.Lock()
+	c.subs[msg.ID] = op
+	c.mu.Unlock()
+
+	go c.execute(ctx, msg.ID, op, req)
+	return nil
+}
+
+// execute runs the operation, subscriptions keep sending results
+// until the context is cancelled
+func (c *wsConn) execute(ctx context.Context, id string, op *wsOp, req gqlReq) {
+	defer c.done(id, op)
+
+	if err := checkOpName(req); err != nil {
+		c.writeErrors(id, op, []core.Error{toError(err)})
+		return
+	}
+
+	gj := c.h.gj
+
+	rc := &core.ReqConfig{Header: c.header}
+
+	if pq := req.Ext.PersistedQuery; pq != nil && pq.Sha256Hash != "" {
+		rc.APQKey = pq.Sha256Hash
+	}
+
+	if ot, _ := core.Operation(req.Query); ot != core.OpSubscription {
+		res, err := gj.GraphQL(ctx, req.Query, req.Vars, rc)
+		if err != nil && len(res.Data) == 0 {
+			c.writeErrors(id, op, res.Errors)
+			return
+		}
+		if err := c.writeResult(id, res); err != nil {
+			return
+		}
+		c.complete(id, op)
+		return
+	}
+
+	m, err := gj.Subscribe(ctx, req.Query, req.Vars, rc)
+	if err != nil {
+		c.writeErrors(id, op, []core.Error{toError(err)})
+		return
+	}
+	defer m.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case res, ok := <-m.Result:
+			// closed when the subscription is stopped (eg. on reload)
+			if !ok {
+				c.complete(id, op)
+				return
+			}
+			// completed by the client while waiting for the result
+			if ctx.Err() != nil {
+				return
+			}
+			if err := c.writeResult(id, res); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// done removes the operation once it's completed, returns false if it
+// was already removed (eg. completed by the client). The id is only
+// removed if it's still used by the same operation
+func (c *wsConn) done(id string, op *wsOp) bool {
+	c.mu.Lock()
+	cur, ok := c.subs[id]
+	ok = ok && cur == op
+	if ok {
+		delete(c.subs, id)
+	}
+	c.mu.Unlock()
+
+	op.cancel()
+	return ok
+}
+
+// complete removes the operation before sending the 'complete' message
+// so the client can reuse the id as soon as it gets the message
+func (c *wsConn) complete(id string, op *wsOp) {
+	if c.done(id, op) {
+		c.write(wsMsg{ID: id, Type: msgComplete}) //nolint: errcheck
+	}
+}
+
+func (c *wsConn) writeResult(id string, res *core.Result) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return c.write(wsMsg{ID: id, Type: msgNext, Payload: b})
+}
+
+// writeErrors ends the operation with an 'error' message, the operation
+// is removed first so the client can reuse the id
+func (c *wsConn) writeErrors(id string, op *wsOp, errs []core.Error) {
+	b, err := json.Marshal(errs)
+	if err != nil {
+		return
+	}
+	if c.done(id, op) {
+		c.write(wsMsg{ID: id, Type: msgError, Payload: b}) //nolint: errcheck
+	}
+}
+
+func (c *wsConn) write(msg wsMsg) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return c.conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// close sends a close message with the code and reason and closes the
+// connection, it returns an error so the read loop exits
+func (c *wsConn) close(code int, reason string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	msg := websocket.FormatCloseMessage(code, reason)
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)) //nolint: errcheck
+	c.conn.Close()
+
+	return fmt.Errorf("websocket closed: %d %s", code, reason)
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goccy/go-json"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newWSServer(conf *Config) *httptest.Server {
+	return httptest.NewServer(New(nil, conf))
+}
+
+func dialWS(t *testing.T, s *httptest.Server, protocols ...string) *websocket.Conn {
+	if protocols == nil {
+		protocols = []string{wsProtocol}
+	}
+	d := websocket.Dialer{Subprotocols: protocols}
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	conn, _, err := d.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func sendMsg(t *testing.T, conn *websocket.Conn, msg string) {
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readMsg(t *testing.T, conn *websocket.Conn) wsMsg {
+	var msg wsMsg
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint: errcheck
+	_, b, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func readClose(t *testing.T, conn *websocket.Conn) int {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint: errcheck
+	_, _, err := conn.ReadMessage()
+
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) {
+		t.Fatalf("expected close error got: %v", err)
+	}
+	return ce.Code
+}
+
+func TestWSConnectionInit(t *testing.T) {
+	s := newWSServer(nil)
+	defer s.Close()
+
+	conn := dialWS(t, s)
+	defer conn.Close()
+
+	assert.Equal(t, wsProtocol, conn.Subprotocol())
+
+	sendMsg(t, conn, `{"type":"connection_init"}`)
+	assert.Equal(t, msgConnectionAck, readMsg(t, conn).Type)
+
+	sendMsg(t, conn, `{"type":"ping","payload":{"a":1}}`)
+	msg := readMsg(t, conn)
+	assert.Equal(t, msgPong, msg.Type)
+	assert.JSONEq(t, `{"a":1}`, string(msg.Payload))
+
+	sendMsg(t, conn, `{"type":"connection_init"}`)
+	assert.Equal(t, closeTooManyInits, readClose(t, conn))
+}
+
+func TestWSInitPayload(t *testing.T) {
+	s := newWSServer(&Config{
+		WSInit: func(payload json.RawMessage) (interface{}, string, error) {
+			var v struct{ Token string }
+			if err := json.Unmarshal(payload, &v); err != nil {
+				return nil, "", err
+			}
+			if v.Token != "secret" {
+				return nil, "", errors.New("invalid token")
+			}
+			return 1, "admin", nil
+		},
+	})
+	defer s.Close()
+
+	conn := dialWS(t, s)
+	defer conn.Close()
+
+	sendMsg(t, conn, `{"type":"connection_init","payload":{"token":"secret"}}`)
+	assert.Equal(t, msgConnectionAck, readMsg(t, conn).Type)
+
+	conn1 := dialWS(t, s)
+	defer conn1.Close()
+
+	sendMsg(t, conn1, `{"type":"connection_init","payload":{"token":"wrong"}}`)
+	assert.Equal(t, closeForbidden, readClose(t, conn1))
+}
+
+func TestWSProtocolErrors(t *testing.T) {
+	s := newWSServer(&Config{WSInitTimeout: 100 * time.Millisecond})
+	defer s.Close()
+
+	tests := []struct {
+		name string
+		msgs []string
+		code int
+	}{
+		{"init_timeout", nil, closeInitTimeout},
+		{"unauthorized", []string{
+			`{"id":"1","type":"subscribe","payload":{"query":"subscription { products { id } }"}}`,
+		}, closeUnauthorized},
+		{"invalid_type", []string{`{"type":"connection_init"}`, `{"type":"unknown"}`}, closeBadRequest},
+		{"invalid_json", []string{`{"type":`}, closeBadRequest},
+		{"missing_id", []string{`{"type":"connection_init"}`, `{"type":"subscribe","payload":{}}`}, closeBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dialWS(t, s)
+			defer conn.Close()
+
+			for _, m := range tt.msgs {
+				sendMsg(t, conn, m)
+				if strings.Contains(m, msgConnectionInit) {
+					assert.Equal(t, msgConnectionAck, readMsg(t, conn).Type)
+				}
+			}
+			assert.Equal(t, tt.code, readClose(t, conn))
+		})
+	}
+}
+
+func TestWSSubprotocol(t *testing.T) {
+	s := newWSServer(nil)
+	defer s.Close()
+
+	conn := dialWS(t, s, "graphql-ws")
+	defer conn.Close()
+
+	assert.Equal(t, closeSubprotocol, readClose(t, conn))
+}
+
+func TestWSCheckOrigin(t *testing.T) {
+	s := newWSServer(nil)
+	defer s.Close()
+
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+	d := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+
+	_, res, err := d.Dial(url, http.Header{"Origin": {"http://evil.example.com"}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	conn, _, err := d.Dial(url, http.Header{"Origin": {s.URL}})
+	assert.NoError(t, err)
+	conn.Close()
+
+	s1 := newWSServer(&Config{WSCheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "http://app.example.com"
+	}})
+	defer s1.Close()
+
+	url = "ws" + strings.TrimPrefix(s1.URL, "http")
+
+	conn, _, err = d.Dial(url, http.Header{"Origin": {"http://app.example.com"}})
+	assert.NoError(t, err)
+	conn.Close()
+}
+
+func TestWSReadLimit(t *testing.T) {
+	s := newWSServer(&Config{MaxBodySize: 100})
+	defer s.Close()
+
+	conn := dialWS(t, s)
+	defer conn.Close()
+
+	sendMsg(t, conn, `{"type":"connection_init","payload":{"a":"`+strings.Repeat("a", 200)+`"}}`)
+	assert.Equal(t, websocket.CloseMessageTooBig, readClose(t, conn))
+}
+
+func TestWSReuseID(t *testing.T) {
+	s := newWSServer(nil)
+	defer s.Close()
+
+	conn := dialWS(t, s)
+	defer conn.Close()
+
+	sendMsg(t, conn, `{"type":"connection_init"}`)
+	assert.Equal(t, msgConnectionAck, readMsg(t, conn).Type)
+
+	// the id can be reused as soon as the operation ends
+	for i := 0; i < 20; i++ {
+		sendMsg(t, conn, `{"id":"1","type":"subscribe","payload":{`+
+			`"query":"query getProducts { products { id } }","operationName":"getUsers"}}`)
+
+		msg := readMsg(t, conn)
+		assert.Equal(t, msgError, msg.Type)
+		assert.Equal(t, "1", msg.ID)
+	}
+}
+
+func TestWSDoneKeepsReusedID(t *testing.T) {
+	c := &wsConn{subs: make(map[string]*wsOp)}
+
+	_, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	op1 := &wsOp{cancel: cancel1}
+	op2 := &wsOp{cancel: cancel2}
+
+	// op1 was completed by the client and the id reused by op2
+	c.subs["1"] = op2
+
+	assert.False(t, c.done("1", op1))
+	assert.Equal(t, op2, c.subs["1"])
+	assert.NoError(t, ctx2.Err())
+
+	assert.True(t, c.done("1", op2))
+	assert.Empty(t, c.subs)
+}
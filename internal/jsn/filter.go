@@ -5,15 +5,32 @@ import (
 	"hash/maphash"
 )
 
+// Key is a key to keep when filtering, the object (or list of objects)
+// value of the key is filtered using the nested keys if any
+type Key struct {
+	Name string
+	Keys []Key
+}
+
 // Filter function filters the JSON keeping only the provided keys and removing all others
 func Filter(w *bytes.Buffer, b []byte, keys []string) error {
+	fk := make([]Key, len(keys))
+	for i := range keys {
+		fk[i] = Key{Name: keys[i]}
+	}
+	return FilterKeys(w, b, fk)
+}
+
+// FilterKeys function is the same as Filter but also filters the values of the
+// keys that have nested keys
+func FilterKeys(w *bytes.Buffer, b []byte, keys []Key) error {
 	var err error
-	kmap := make(map[uint64]struct{}, len(keys))
+	kmap := make(map[uint64][]Key, len(keys))
 	h := maphash.Hash{}
 
 	for i := range keys {
-		_, _ = h.WriteString(keys[i])
-		kmap[h.Sum64()] = struct{}{}
+		_, _ = h.WriteString(keys[i].Name)
+		kmap[h.Sum64()] = keys[i].Keys
 		h.Reset()
 	}
 
@@ -135,7 +152,7 @@ func Filter(w *bytes.Buffer, b []byte, keys []string) error {
 			e = 0
 
 			_, _ = h.Write(k)
-			_, ok := kmap[h.Sum64()]
+			nk, ok := kmap[h.Sum64()]
 			h.Reset()
 
 			if !ok {
@@ -148,6 +165,14 @@ func Filter(w *bytes.Buffer, b []byte, keys []string) error {
 				}
 			}
 
+			if len(nk) != 0 {
+				if err := filterValue(w, cb, len(k)+2, nk); err != nil {
+					return err
+				}
+				field++
+				continue
+			}
+
 			sk := 0
 			for i := 0; i < len(cb); i++ {
 				if cb[i] == '\n' || cb[i] == '\t' {
@@ -185,3 +210,21 @@ func Filter(w *bytes.Buffer, b []byte, keys []string) error {
 
 	return nil
 }
+
+// filterValue writes the key and the value filtered using the nested
+// keys, values that are not an object or a list are written as is
+func filterValue(w *bytes.Buffer, cb []byte, n int, keys []Key) error {
+	i := n + bytes.IndexByte(cb[n:], ':') + 1
+	v := bytes.TrimSpace(cb[i:])
+
+	if _, err := w.Write(cb[:(len(cb) - len(v))]); err != nil {
+		return err
+	}
+
+	if len(v) != 0 && (v[0] == '{' || v[0] == '[') {
+		return FilterKeys(w, v, keys)
+	}
+
+	_, err := w.Write(v)
+	return err
+}
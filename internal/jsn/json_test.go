@@ -343,6 +343,29 @@ func TestFilter2(t *testing.T) {
 	}
 }
 
+func TestFilterKeys(t *testing.T) {
+	value := `[{"id": 1, "amount": 100, "card": {"last4": "4242", "brand": "visa", "exp": {"month": 1, "year": 2030}}, "items": [{"name": "a", "qty": 1}, {"name": "b", "qty": 2}]}, {"id": 2, "amount": 150, "card": null, "items": []}]`
+
+	keys := []jsn.Key{
+		{Name: "id"},
+		{Name: "card", Keys: []jsn.Key{{Name: "last4"}, {Name: "exp", Keys: []jsn.Key{{Name: "year"}}}}},
+		{Name: "items", Keys: []jsn.Key{{Name: "name"}}},
+	}
+
+	var b bytes.Buffer
+	err := jsn.FilterKeys(&b, []byte(value), keys)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := `[{"id": 1,"card": {"last4": "4242","exp": {"year": 2030}},"items": [{"name": "a"},{"name": "b"}]},{"id": 2,"card": null,"items": []}]`
+
+	if b.String() != expected {
+		t.Log(b.String())
+		t.Error("Does not match expected json")
+	}
+}
+
 func TestStrip(t *testing.T) {
 	path1 := [][]byte{[]byte("data"), []byte("users")}
 	value1 := jsn.Strip([]byte(input3), path1)